@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -52,6 +53,13 @@ TARGET following the same matching rule as command "targets".
 Except it should match exact one target.
 Please checkout using "targets --help".
 Otherwise the command will fail.
+`
+
+	depsUsage = `deps TARGET
+Print the dependency tree of TARGET.
+TARGET following the same matching rule as command "targets".
+Except it should match exact one target.
+Please checkout using "targets --help".
 `
 
 	logUsage = `log TARGET
@@ -85,6 +93,10 @@ var (
 func cmdRunner(cmd cli.Command) func(c *cobra.Command, args []string) {
 	return func(c *cobra.Command, args []string) {
 		if err := contextBuilder.BuildAndRun(c.Context(), cmd, args...); err != nil {
+			var exitErr *cli.ExitCodeError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.Code)
+			}
 			os.Exit(1)
 		}
 	}
@@ -103,6 +115,42 @@ func setupBuildCmdFlags(c *cobra.Command, build *cli.BuildCmd) {
 		false,
 		"Force rebuild the specified targets.",
 	)
+	c.Flags().BoolVar(
+		&build.ForceAll,
+		"force-all",
+		false,
+		"Force rebuild the specified targets and all their dependencies.",
+	)
+	c.Flags().BoolVarP(
+		&build.Verbose,
+		"verbose", "v",
+		false,
+		"Display output of running tasks.",
+	)
+	c.Flags().IntVar(
+		&build.MaxFailures,
+		"max-failures",
+		0,
+		"Stop starting new tasks after the number of failed tasks, 0 means unlimited.",
+	)
+	c.Flags().StringVar(
+		&build.BEPFile,
+		"bep-file",
+		"",
+		"Write Build Event Protocol messages as newline-delimited JSON to the file.",
+	)
+	c.Flags().StringVar(
+		&build.SummaryFile,
+		"summary-file",
+		"",
+		"Write a JSON build summary to the file after completion.",
+	)
+	c.Flags().StringVar(
+		&build.OutputDir,
+		"output-dir",
+		"",
+		"Override the base output directory, relative to the repository root if not absolute.",
+	)
 }
 
 func init() {
@@ -126,7 +174,7 @@ func main() {
 		&contextBuilder.WorkDir,
 		"chdir", "C",
 		"",
-		"Working directory.",
+		"Working directory. Default is $REPOS_ROOT if set, otherwise the current directory.",
 	)
 	cmd.PersistentFlags().BoolVar(
 		&contextBuilder.TextUI,
@@ -134,6 +182,18 @@ func main() {
 		contextBuilder.TextUI,
 		"Disable color terminal support.",
 	)
+	cmd.PersistentFlags().StringVar(
+		&contextBuilder.Output,
+		"output",
+		cli.OutputAuto,
+		"Output format: text or json. Color terminal is used if available when not specified.",
+	)
+	cmd.PersistentFlags().IntVarP(
+		&contextBuilder.NumWorkers,
+		"jobs", "j",
+		0,
+		"Number of tasks to run in parallel. Default is max-workers in REPOS.yaml or the number of CPUs.",
+	)
 	cmd.PersistentFlags().BoolVar(
 		&contextBuilder.LocalScope,
 		"local",
@@ -141,20 +201,46 @@ func main() {
 		"Restrict in the local scope - find the closest REPOS.yaml instead of the top-most one.",
 	)
 
+	listProjects := &cli.ListProjectsCmd{}
 	listProjectsCmd := &cobra.Command{
 		Use:     "projects",
 		Aliases: []string{"p"},
 		Short:   "List all projects.",
-		Run:     cmdRunner(&cli.ListProjectsCmd{}),
+		Run:     cmdRunner(listProjects),
 	}
+	listProjectsCmd.Flags().BoolVarP(
+		&listProjects.Verbose,
+		"verbose", "v",
+		false,
+		"Print number of targets and results of last builds.",
+	)
 	cmd.AddCommand(listProjectsCmd)
 
+	listTargets := &cli.ListTargetsCmd{}
 	listTargetsCmd := &cobra.Command{
 		Use:     targetsUsage,
 		Aliases: []string{"t"},
 		Short:   "List all targets or matched targets with specified patterns.",
-		Run:     cmdRunner(&cli.ListTargetsCmd{}),
+		Run:     cmdRunner(listTargets),
 	}
+	listTargetsCmd.Flags().StringArrayVar(
+		&listTargets.Tools,
+		"tool",
+		nil,
+		"Only list targets using the tool. Can be repeated. Empty matches targets without a tool.",
+	)
+	listTargetsCmd.Flags().BoolVar(
+		&listTargets.NoTool,
+		"no-tool",
+		false,
+		"Only list targets without a tool, combined with --tool.",
+	)
+	listTargetsCmd.Flags().StringVar(
+		&listTargets.Sort,
+		"sort",
+		cli.TargetSortName,
+		"Sort targets by name, tool or status (failed, never built, skipped, succeeded).",
+	)
 	cmd.AddCommand(listTargetsCmd)
 
 	checkCmd := &cobra.Command{
@@ -164,20 +250,47 @@ func main() {
 	}
 	cmd.AddCommand(checkCmd)
 
+	status := &cli.StatusCmd{}
 	statusCmd := &cobra.Command{
 		Use:     statusUsage,
 		Aliases: []string{"st"},
 		Short:   "Print task status.",
-		Run:     cmdRunner(&cli.StatusCmd{}),
+		Run:     cmdRunner(status),
 	}
+	statusCmd.Flags().BoolVar(
+		&status.ExitCode,
+		"exit-code",
+		false,
+		"Exit with 1 if any target failed or never built, 2 if any target is not found.",
+	)
 	cmd.AddCommand(statusCmd)
 
+	depsCmd := &cobra.Command{
+		Use:   depsUsage,
+		Short: "Print the dependency tree of a target.",
+		Run:   cmdRunner(&cli.DepsCmd{}),
+	}
+	cmd.AddCommand(depsCmd)
+
+	logs := &cli.LogCmd{}
 	logCmd := &cobra.Command{
 		Use:     logUsage,
 		Aliases: []string{"logs"},
 		Short:   "Print task logs.",
-		Run:     cmdRunner(&cli.LogCmd{}),
+		Run:     cmdRunner(logs),
 	}
+	logCmd.Flags().BoolVar(
+		&logs.Internal,
+		"internal",
+		false,
+		"Print the internal tool log instead of the task output.",
+	)
+	logCmd.Flags().BoolVarP(
+		&logs.Follow,
+		"follow", "f",
+		false,
+		"Build the target and stream the log until the build completes.",
+	)
 	cmd.AddCommand(logCmd)
 
 	build := &cli.BuildCmd{}
@@ -198,6 +311,20 @@ func main() {
 		Run:     cmdRunner(run),
 	}
 	setupBuildCmdFlags(runCmd, &run.Build)
+	runCmd.Flags().StringArrayVar(
+		&run.Env,
+		"env",
+		nil,
+		"Set environment variable KEY=VALUE for the executable, or KEY to inherit from current environment. Can be repeated.",
+	)
 	cmd.AddCommand(runCmd)
+
+	// User config provides the defaults, and is overridden by flags.
+	userConfig, err := cli.LoadUserConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		os.Exit(1)
+	}
+	contextBuilder.ApplyUserConfig(userConfig)
 	cmd.Execute()
 }
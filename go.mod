@@ -3,14 +3,17 @@ module repos
 go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/easeway/langx.go v0.0.0-20170304050229-26b1f7c6dca0
 	github.com/karrick/godirwalk v1.15.6
 	github.com/spf13/cobra v1.2.1
 	github.com/zabawaba99/go-gitignore v0.0.0-20200117185801-39e6bddfb292
+	golang.org/x/term v0.5.0
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/sys v0.5.0 // indirect
 )
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"repos/pkg/repos"
+)
+
+// BEPEventHandler writes Build Event Protocol messages as newline-delimited JSON.
+// Only a subset of Bazel's BEP is implemented: BuildStarted, TargetComplete,
+// ActionCompleted and BuildFinished.
+type BEPEventHandler struct {
+	encoder *json.Encoder
+	uuid    string
+	err     error
+}
+
+type bepEvent struct {
+	ID             bepEventID         `json:"id"`
+	Children       []bepEventID       `json:"children,omitempty"`
+	LastMessage    bool               `json:"lastMessage,omitempty"`
+	Started        *bepBuildStarted   `json:"started,omitempty"`
+	Finished       *bepBuildFinished  `json:"finished,omitempty"`
+	Completed      *bepTargetComplete `json:"completed,omitempty"`
+	ActionExecuted *bepActionExecuted `json:"action,omitempty"`
+}
+
+type bepEventID struct {
+	BuildStarted    *struct{}           `json:"started,omitempty"`
+	BuildFinished   *struct{}           `json:"buildFinished,omitempty"`
+	TargetCompleted *bepTargetID        `json:"targetCompleted,omitempty"`
+	ActionCompleted *bepActionCompleted `json:"actionCompleted,omitempty"`
+}
+
+type bepTargetID struct {
+	Label string `json:"label"`
+}
+
+type bepActionCompleted struct {
+	Label         string `json:"label"`
+	PrimaryOutput string `json:"primaryOutput,omitempty"`
+}
+
+type bepBuildStarted struct {
+	UUID             string `json:"uuid"`
+	StartTimeMillis  int64  `json:"startTimeMillis"`
+	BuildToolVersion string `json:"buildToolVersion,omitempty"`
+	Command          string `json:"command"`
+	WorkingDirectory string `json:"workingDirectory,omitempty"`
+	WorkspaceDir     string `json:"workspaceDirectory,omitempty"`
+}
+
+type bepBuildFinished struct {
+	OverallSuccess   bool        `json:"overallSuccess"`
+	ExitCode         bepExitCode `json:"exitCode"`
+	FinishTimeMillis int64       `json:"finishTimeMillis"`
+}
+
+type bepExitCode struct {
+	Name string `json:"name"`
+	Code int    `json:"code"`
+}
+
+type bepTargetComplete struct {
+	Success bool `json:"success"`
+}
+
+type bepActionExecuted struct {
+	Success   bool   `json:"success"`
+	Type      string `json:"type"`
+	Label     string `json:"label"`
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewBEPEventHandler creates a BEPEventHandler writing to w.
+func NewBEPEventHandler(w io.Writer) *BEPEventHandler {
+	var id [16]byte
+	rand.Read(id[:])
+	return &BEPEventHandler{encoder: json.NewEncoder(w), uuid: hex.EncodeToString(id[:])}
+}
+
+// Err returns the first error when writing messages.
+func (h *BEPEventHandler) Err() error {
+	return h.err
+}
+
+// HandleEvent implements repos.EventHandler.
+func (h *BEPEventHandler) HandleEvent(ctx context.Context, event repos.DispatcherEvent) {
+	switch ev := event.(type) {
+	case *repos.DispatcherStartEvent:
+		children := make([]bepEventID, 0, len(ev.Graph().Tasks)+1)
+		for name := range ev.Graph().Tasks {
+			children = append(children, bepEventID{TargetCompleted: &bepTargetID{Label: name}})
+		}
+		children = append(children, bepEventID{BuildFinished: &struct{}{}})
+		h.write(&bepEvent{
+			ID:       bepEventID{BuildStarted: &struct{}{}},
+			Children: children,
+			Started: &bepBuildStarted{
+				UUID:             h.uuid,
+				StartTimeMillis:  time.Now().UnixNano() / int64(time.Millisecond),
+				Command:          "build",
+				WorkingDirectory: ev.Graph().Repo.WorkDir,
+				WorkspaceDir:     ev.Graph().Repo.RootDir,
+			},
+		})
+	case *repos.TaskCompleteEvent:
+		task := ev.Task
+		actionID := &bepActionCompleted{Label: task.Name()}
+		if task.Outputs != nil {
+			actionID.PrimaryOutput = task.Outputs.Primary
+		}
+		action := &bepActionExecuted{
+			Success:   !task.Failed(),
+			Type:      task.Target.ToolName(),
+			Label:     task.Name(),
+			StartTime: task.StartTime.Format(time.RFC3339Nano),
+			EndTime:   task.EndTime.Format(time.RFC3339Nano),
+			Skipped:   task.Skipped(),
+		}
+		if task.Failed() {
+			action.Error = task.Err.Error()
+		}
+		h.write(&bepEvent{ID: bepEventID{ActionCompleted: actionID}, ActionExecuted: action})
+		h.write(&bepEvent{
+			ID:        bepEventID{TargetCompleted: &bepTargetID{Label: task.Name()}},
+			Completed: &bepTargetComplete{Success: !task.Failed()},
+		})
+	case *repos.DispatcherEndEvent:
+		finished := &bepBuildFinished{
+			OverallSuccess:   ev.Err == nil,
+			ExitCode:         bepExitCode{Name: "SUCCESS"},
+			FinishTimeMillis: time.Now().UnixNano() / int64(time.Millisecond),
+		}
+		if ev.Err != nil {
+			finished.ExitCode = bepExitCode{Name: "BUILD_FAILURE", Code: 1}
+		}
+		h.write(&bepEvent{
+			ID:          bepEventID{BuildFinished: &struct{}{}},
+			LastMessage: true,
+			Finished:    finished,
+		})
+	}
+}
+
+func (h *BEPEventHandler) write(event *bepEvent) {
+	if h.err != nil {
+		return
+	}
+	h.err = h.encoder.Encode(event)
+}
@@ -4,19 +4,35 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"repos/pkg/repos"
 )
 
 // BuildCmd provides a build command.
 type BuildCmd struct {
-	Quiet bool
-	Force bool
+	Quiet       bool
+	Force       bool
+	ForceAll    bool
+	Verbose     bool
+	MaxFailures int
+	BEPFile     string
+	SummaryFile string
+	// OutputDir overrides the base output directory, relative to the root
+	// of the repository if not absolute.
+	OutputDir string
+
+	// eventHandler overrides the event handler from UI if present.
+	eventHandler repos.EventHandler
 }
 
 // Execute executes the command.
 func (c *BuildCmd) Execute(ctx context.Context, cctx *Context, args ...string) error {
-	names, err := cctx.Repo.ResolveTargetNames(args...)
+	names, err := cctx.Repo.ResolveTargetNamesSorted(args...)
 	if err != nil {
 		return err
 	}
@@ -26,11 +42,16 @@ func (c *BuildCmd) Execute(ctx context.Context, cctx *Context, args ...string) e
 
 // Build builds the specified targets.
 func (c *BuildCmd) Build(ctx context.Context, cctx *Context, targets ...string) (*repos.TaskGraph, error) {
+	defer c.overrideOutputDir(cctx.Repo)()
 	g, err := cctx.Repo.Plan(targets...)
 	if err != nil {
 		return nil, err
 	}
-	if c.Force {
+	if c.ForceAll {
+		for _, task := range g.Tasks {
+			task.NoSkip = true
+		}
+	} else if c.Force {
 		for _, name := range targets {
 			if task := g.Tasks[name]; task != nil {
 				task.NoSkip = true
@@ -38,16 +59,67 @@ func (c *BuildCmd) Build(ctx context.Context, cctx *Context, targets ...string)
 		}
 	}
 	disp := repos.NewDispatcher(g)
+	if cctx.NumWorkers > 0 {
+		disp.NumWorkers = cctx.NumWorkers
+	}
+	disp.MaxFailures = c.MaxFailures
 	var options EventHandlingOptions
 	if !c.Quiet {
 		options.LogReader = OpenTaskLog
 	}
+	options.Verbose = c.Verbose
 	disp.EventHandler = cctx.UI.TaskEventHandler(options)
+	if c.eventHandler != nil {
+		disp.EventHandler = c.eventHandler
+	}
+	if h, ok := disp.EventHandler.(TaskOutputHandler); ok {
+		disp.TaskOutput = h.TaskOutput
+	}
+	var bep *BEPEventHandler
+	if c.BEPFile != "" {
+		f, err := os.Create(c.BEPFile)
+		if err != nil {
+			return nil, fmt.Errorf("create BEP file %q error: %w", c.BEPFile, err)
+		}
+		defer f.Close()
+		bep = NewBEPEventHandler(f)
+		disp.EventHandler = repos.NewMultiEventHandler(disp.EventHandler, bep)
+	}
+	hooks := cctx.Repo.Meta().Hooks
+	if hooks.PreBuild != "" {
+		if err := runHook(ctx, cctx, hooks.PreBuild); err != nil {
+			return nil, fmt.Errorf("pre-build hook error: %w", err)
+		}
+	}
+	startTime := time.Now()
 	err = disp.Run(ctx)
+	duration := time.Since(startTime)
+	if hooks.PostBuild != "" {
+		result := "ok"
+		if err != nil {
+			result = "failed"
+		}
+		// Post-build hook always runs, even if the build is canceled.
+		if hookErr := runHook(context.Background(), cctx, hooks.PostBuild, "REPOS_BUILD_RESULT="+result); hookErr != nil && err == nil {
+			err = fmt.Errorf("post-build hook error: %w", hookErr)
+		}
+	}
+	if err == nil && bep != nil && bep.Err() != nil {
+		return g, fmt.Errorf("write BEP file %q error: %w", c.BEPFile, bep.Err())
+	}
+	if c.SummaryFile != "" {
+		summary := NewBuildSummary(g, duration)
+		summary.Cache = disp.CacheStats
+		if writeErr := summary.WriteFile(c.SummaryFile); writeErr != nil && err == nil {
+			return g, fmt.Errorf("write summary file %q error: %w", c.SummaryFile, writeErr)
+		}
+	}
 	if err != nil {
 		switch {
+		case errors.Is(err, repos.ErrSomeTaskFailed) && err != repos.ErrSomeTaskFailed:
+			err = fmt.Errorf(`%v%s, use "status|log TARGET" to inspect the details`, err, failureDetails(g))
 		case errors.Is(err, repos.ErrSomeTaskFailed) || errors.Is(err, repos.ErrIncomplete):
-			err = fmt.Errorf(`some tasks failed, use "status|log TARGET" to inspect the details`)
+			err = fmt.Errorf(`some tasks failed%s, use "status|log TARGET" to inspect the details`, failureDetails(g))
 		case errors.Is(err, context.DeadlineExceeded):
 			err = fmt.Errorf("timeout")
 		case errors.Is(err, context.Canceled):
@@ -56,3 +128,54 @@ func (c *BuildCmd) Build(ctx context.Context, cctx *Context, targets ...string)
 	}
 	return g, err
 }
+
+// overrideOutputDir applies OutputDir to the repo and returns a function
+// restoring the previous output directory.
+func (c *BuildCmd) overrideOutputDir(repo *repos.Repo) func() {
+	prev := repo.OutBaseDir
+	if c.OutputDir != "" {
+		repo.OutBaseDir = c.OutputDir
+		if !filepath.IsAbs(c.OutputDir) {
+			repo.OutBaseDir = filepath.Join(repo.RootDir, c.OutputDir)
+		}
+	}
+	return func() {
+		repo.OutBaseDir = prev
+	}
+}
+
+// failureDetails describes how many failed tasks timed out or were canceled.
+func failureDetails(g *repos.TaskGraph) string {
+	var timedOut, canceled int
+	for _, task := range g.Tasks {
+		switch {
+		case task.FailedWithTimeout():
+			timedOut++
+		case task.FailedWithCancel():
+			canceled++
+		}
+	}
+	var details []string
+	if timedOut > 0 {
+		details = append(details, fmt.Sprintf("%d timed out", timedOut))
+	}
+	if canceled > 0 {
+		details = append(details, fmt.Sprintf("%d canceled", canceled))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, ", ") + ")"
+}
+
+func runHook(ctx context.Context, cctx *Context, command string, envs ...string) error {
+	cmd := exec.CommandContext(ctx, cctx.Repo.ShellProgram(), "-c", command)
+	cmd.Dir = cctx.Repo.RootDir
+	cmd.Env = append(os.Environ(), envs...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if _, ok := cctx.UI.(*JSONPrinter); ok {
+		// Keep stdout for the JSON records only.
+		cmd.Stdout = os.Stderr
+	}
+	return cmd.Run()
+}
@@ -2,20 +2,58 @@ package cli
 
 import (
 	"context"
+	"fmt"
+	"sort"
 )
 
+// maxExitCode is the largest exit code not reserved by shells.
+const maxExitCode = 125
+
 // CheckCmd checks the integrity of all projects.
 type CheckCmd struct {
 }
 
 // Execute executes the command.
+// All errors are reported, and the exit code is the number of errors.
 func (c *CheckCmd) Execute(ctx context.Context, cctx *Context, args ...string) error {
+	projects := cctx.Repo.Projects()
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Name < projects[j].Name
+	})
 	var names []string
-	for _, project := range cctx.Repo.Projects() {
-		for _, target := range project.Targets() {
+	var errs []error
+	// Collect all unresolvable dependencies first, as planning stops at the
+	// first one.
+	for _, project := range projects {
+		for _, target := range project.TargetsSorted() {
 			names = append(names, target.Name.GlobalName())
+			errs = append(errs, target.CheckDependencies(cctx.Repo)...)
+		}
+	}
+	if len(errs) == 0 {
+		// Plan each target separately so an error doesn't hide errors from
+		// other targets. The same error may be reported via multiple targets
+		// depending on the broken one.
+		reported := make(map[string]struct{})
+		for _, name := range names {
+			if _, err := cctx.Repo.Plan(name); err != nil {
+				if _, ok := reported[err.Error()]; ok {
+					continue
+				}
+				reported[err.Error()] = struct{}{}
+				errs = append(errs, err)
+			}
 		}
 	}
-	_, err := cctx.Repo.Plan(names...)
-	return err
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, err := range errs {
+		cctx.UI.PrintError(err)
+	}
+	code := len(errs)
+	if code > maxExitCode {
+		code = maxExitCode
+	}
+	return &ExitCodeError{Code: code, Err: fmt.Errorf("%d errors found", len(errs))}
 }
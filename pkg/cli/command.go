@@ -28,50 +28,119 @@ type TaskLogReader func(task *repos.Task) (io.ReadCloser, error)
 // EventHandlingOptions specifies options for how to handle task events.
 type EventHandlingOptions struct {
 	LogReader TaskLogReader
+	// Verbose requests the output of running tasks to be displayed.
+	Verbose bool
+}
+
+// TaskOutputHandler is optionally implemented by an event handler to
+// receive the output of tasks while they are running.
+type TaskOutputHandler interface {
+	TaskOutput(task *repos.Task) io.Writer
 }
 
 // UserInterface defines the abstraction for interacting with the user.
 type UserInterface interface {
 	TaskEventHandler(options EventHandlingOptions) repos.EventHandler
 	PrintProjectList([]*repos.Project)
+	PrintProjectSummaryList([]*ProjectSummary)
 	PrintTargetList([]*repos.Target)
 	PrintLog(io.Reader)
 	PrintTaskStatus(name string, result *repos.TaskResult, outputs *repos.OutputFiles)
+	// PrintDependencyTree prints the dependencies of root recursively.
+	// The tree maps a target to its direct dependencies.
+	PrintDependencyTree(root *repos.Target, tree map[*repos.Target][]*repos.Target)
+	PrintBuildSummary(summary *BuildSummary)
+	PrintWarning(msg string)
 	PrintError(err error)
 }
 
+// ExitCodeError is an error requesting a specific exit code of the process.
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+// Error implements error.
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
 // Context provides information about the environment for commands.
 type Context struct {
 	Repo *repos.Repo
 	UI   UserInterface
+	// NumWorkers overrides the number of parallel workers if not zero.
+	NumWorkers int
 }
 
+// RootDirEnv is the environment variable specifying the working directory
+// if ContextBuilder.WorkDir is not specified.
+const RootDirEnv = "REPOS_ROOT"
+
+// Values of ContextBuilder.Output.
+const (
+	OutputAuto = ""
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
 // ContextBuilder is used to build Context.
 type ContextBuilder struct {
 	WorkDir    string
 	TextUI     bool
 	LocalScope bool
+	// Output selects the UserInterface, one of OutputAuto, OutputText and OutputJSON.
+	Output string
+	// NumWorkers specifies the number of parallel workers for building.
+	// If zero, the default from root metadata or the number of CPUs is used.
+	NumWorkers int
 }
 
 // BuildContext creates a context.
 func (b *ContextBuilder) BuildContext() (*Context, error) {
 	c := &Context{
-		UI: &TextPrinter{},
+		UI:         &TextPrinter{},
+		NumWorkers: b.NumWorkers,
 	}
-	if !b.TextUI {
-		if term := os.Getenv("TERM"); term != "" && term != "dumb" {
-			c.UI = &TermPrinter{}
+	switch b.Output {
+	case OutputAuto:
+		if !b.TextUI {
+			if term := os.Getenv("TERM"); term != "" && term != "dumb" {
+				c.UI = &TermPrinter{}
+			}
 		}
+	case OutputText:
+	case OutputJSON:
+		c.UI = NewJSONPrinter()
+	default:
+		err := fmt.Errorf("unknown output format %q", b.Output)
+		c.UI.PrintError(err)
+		return nil, err
+	}
+	if b.NumWorkers < 0 {
+		err := fmt.Errorf("invalid number of jobs %d", b.NumWorkers)
+		c.UI.PrintError(err)
+		return nil, err
 	}
 	scope := repos.RepoScopeGlobal
 	if b.LocalScope {
 		scope = repos.RepoScopeLocal
 	}
-	repo, err := repos.NewRepo(b.WorkDir, scope)
+	workDir := b.WorkDir
+	if workDir == "" {
+		workDir = os.Getenv(RootDirEnv)
+	}
+	repo, err := repos.NewRepo(workDir, scope)
 	if err != nil {
 		c.UI.PrintError(err)
 		return nil, err
 	}
+	repo.WarningHandler = c.UI.PrintWarning
 	if err := repo.LoadProjects(); err != nil {
 		c.UI.PrintError(err)
 		return nil, err
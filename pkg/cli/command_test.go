@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"repos/pkg/repos/meta"
+)
+
+func makeTestRepo(t *testing.T) string {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, meta.RootFile), []byte("absolute-root: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestBuildContextWorkDir(t *testing.T) {
+	envDir, chDir := makeTestRepo(t), makeTestRepo(t)
+	t.Setenv(RootDirEnv, envDir)
+
+	// REPOS_ROOT is used when --chdir is not specified.
+	b := &ContextBuilder{Output: OutputText}
+	cctx, err := b.BuildContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cctx.Repo.WorkDir != envDir || cctx.Repo.RootDir != envDir {
+		t.Errorf("expect repo in %q, got work dir %q and root dir %q", envDir, cctx.Repo.WorkDir, cctx.Repo.RootDir)
+	}
+
+	// --chdir takes precedence over REPOS_ROOT.
+	b.WorkDir = chDir
+	cctx, err = b.BuildContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cctx.Repo.WorkDir != chDir || cctx.Repo.RootDir != chDir {
+		t.Errorf("expect repo in %q, got work dir %q and root dir %q", chDir, cctx.Repo.WorkDir, cctx.Repo.RootDir)
+	}
+}
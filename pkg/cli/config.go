@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/easeway/langx.go/mapper"
+)
+
+const (
+	// UserConfigEnv is the environment variable overriding the path of the user config file.
+	UserConfigEnv = "REPOS_CONFIG"
+)
+
+// UserConfig defines personal defaults of ContextBuilder.
+// It's loaded from $XDG_CONFIG_HOME/repos/config.yaml or ~/.config/repos/config.yaml.
+type UserConfig struct {
+	// TextUI is the default of --script.
+	TextUI bool `json:"script,omitempty"`
+	// LocalScope is the default of --local.
+	LocalScope bool `json:"local,omitempty"`
+	// Output is the default of --output.
+	Output string `json:"output,omitempty"`
+	// NumWorkers is the default of --jobs.
+	NumWorkers int `json:"jobs,omitempty"`
+}
+
+// UserConfigFile returns the path of the user config file.
+func UserConfigFile() (string, error) {
+	if fn := os.Getenv(UserConfigEnv); fn != "" {
+		return fn, nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "repos", "config.yaml"), nil
+}
+
+// LoadUserConfig loads the user config file.
+// An empty UserConfig is returned if the file doesn't exist.
+func LoadUserConfig() (*UserConfig, error) {
+	fn, err := UserConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("locate user config error: %w", err)
+	}
+	var config UserConfig
+	var ld mapper.Loader
+	if err := ld.LoadFile(fn); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &config, nil
+		}
+		return nil, fmt.Errorf("load %s error: %w", fn, err)
+	}
+	m := mapper.Mapper{FieldTags: []string{"json", "map"}}
+	if err := m.Map(&config, ld.Map); err != nil {
+		return nil, fmt.Errorf("parse %s error: %w", fn, err)
+	}
+	return &config, nil
+}
+
+// ApplyUserConfig uses the user config as the defaults.
+// It must be called before command line flags are parsed.
+func (b *ContextBuilder) ApplyUserConfig(config *UserConfig) {
+	b.TextUI = config.TextUI
+	b.LocalScope = config.LocalScope
+	b.Output = config.Output
+	b.NumWorkers = config.NumWorkers
+}
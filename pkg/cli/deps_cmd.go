@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"repos/pkg/repos"
+)
+
+// DepsCmd prints the dependency tree of a target.
+type DepsCmd struct {
+}
+
+// Execute executes the command.
+func (c *DepsCmd) Execute(ctx context.Context, cctx *Context, args ...string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expect exactly one TARGET")
+	}
+	target, err := cctx.MatchOneTarget(args[0])
+	if err != nil {
+		return err
+	}
+	tree := make(map[*repos.Target][]*repos.Target)
+	pending := []*repos.Target{target}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, exist := tree[current]; exist {
+			continue
+		}
+		deps, err := current.Dependencies(cctx.Repo)
+		if err != nil {
+			return err
+		}
+		sort.Slice(deps, func(i, j int) bool {
+			return deps[i].Name.GlobalName() < deps[j].Name.GlobalName()
+		})
+		tree[current] = deps
+		pending = append(pending, deps...)
+	}
+	cctx.UI.PrintDependencyTree(target, tree)
+	return nil
+}
+
+// walkDependencyTree visits the tree in depth-first order starting from root.
+// The dependencies of a target are only visited the first time the target is
+// visited, and repeated is true for subsequent visits.
+func walkDependencyTree(root *repos.Target, tree map[*repos.Target][]*repos.Target, fn func(target *repos.Target, depth int, repeated bool)) {
+	visited := make(map[*repos.Target]struct{})
+	var walk func(*repos.Target, int)
+	walk = func(target *repos.Target, depth int) {
+		_, repeated := visited[target]
+		fn(target, depth, repeated && len(tree[target]) > 0)
+		if repeated {
+			return
+		}
+		visited[target] = struct{}{}
+		for _, dep := range tree[target] {
+			walk(dep, depth+1)
+		}
+	}
+	walk(root, 0)
+}
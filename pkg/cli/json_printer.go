@@ -0,0 +1,329 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"repos/pkg/repos"
+)
+
+// Values of JSONRecord.Type.
+const (
+	JSONRecordProject    = "project"
+	JSONRecordTarget     = "target"
+	JSONRecordLog        = "log"
+	JSONRecordTaskStatus = "task-status"
+	JSONRecordDepsTree   = "deps-tree"
+	JSONRecordSummary    = "summary"
+	JSONRecordEvent      = "event"
+	JSONRecordWarning    = "warning"
+	JSONRecordError      = "error"
+)
+
+// Values of JSONEvent.Type.
+const (
+	JSONEventBuildStart   = "build-start"
+	JSONEventBuildEnd     = "build-end"
+	JSONEventProgress     = "progress"
+	JSONEventTaskStart    = "task-start"
+	JSONEventTaskComplete = "task-complete"
+)
+
+// JSONTaskStatusUnknown is the value of JSONTaskStatus.Status
+// if the task never ran.
+const JSONTaskStatusUnknown = "unknown"
+
+const jsonPrinterTimeFormat = time.RFC3339Nano
+
+// JSONPrinter provides an output-only UserInterface writing
+// newline-delimited JSON objects (JSONRecord) to stdout.
+type JSONPrinter struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// JSONRecord is the envelope of every JSON object written by JSONPrinter.
+// Only the field corresponding to Type is present.
+type JSONRecord struct {
+	// Type is one of JSONRecordXXX.
+	Type string `json:"type"`
+	// Time is the RFC3339 timestamp when the record is written.
+	Time       string          `json:"time"`
+	Project    *JSONProject    `json:"project,omitempty"`
+	Target     *JSONTarget     `json:"target,omitempty"`
+	TaskStatus *JSONTaskStatus `json:"task-status,omitempty"`
+	Event      *JSONEvent      `json:"event,omitempty"`
+	DepsTree   *JSONDepsNode   `json:"deps-tree,omitempty"`
+	Summary    *BuildSummary   `json:"summary,omitempty"`
+	// Log is a single line of the log without the line terminator.
+	Log string `json:"log,omitempty"`
+	// Message is the content of a warning or an error.
+	Message string `json:"message,omitempty"`
+}
+
+// JSONProject is the payload of JSONRecordProject.
+type JSONProject struct {
+	Name        string `json:"name"`
+	Dir         string `json:"dir"`
+	Description string `json:"description,omitempty"`
+	// Summary is present when listing projects verbosely.
+	Summary *ProjectSummary `json:"summary,omitempty"`
+}
+
+// JSONTarget is the payload of JSONRecordTarget.
+type JSONTarget struct {
+	Name        string   `json:"name"`
+	Tool        string   `json:"tool,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Deps        []string `json:"deps,omitempty"`
+}
+
+// JSONDepsNode is the payload of JSONRecordDepsTree.
+// It's a node in the dependency tree.
+type JSONDepsNode struct {
+	Name string `json:"name"`
+	// Repeated indicates the dependencies of the target are omitted
+	// because they are already present in the tree.
+	Repeated bool           `json:"repeated,omitempty"`
+	Deps     []JSONDepsNode `json:"deps,omitempty"`
+}
+
+// JSONTaskStatus is the payload of JSONRecordTaskStatus.
+type JSONTaskStatus struct {
+	Name string `json:"name"`
+	// Status is one of TaskStatusSucceeded, TaskStatusSkipped, TaskStatusFailed
+	// and JSONTaskStatusUnknown.
+	Status                string            `json:"status"`
+	StartTime             string            `json:"start-time,omitempty"`
+	EndTime               string            `json:"end-time,omitempty"`
+	SuccessBuildStartTime string            `json:"success-build-start-time,omitempty"`
+	SuccessBuildEndTime   string            `json:"success-build-end-time,omitempty"`
+	PeakRSS               int64             `json:"peak-rss,omitempty"`
+	UserCPUMs             int64             `json:"user-cpu-ms,omitempty"`
+	Error                 string            `json:"error,omitempty"`
+	Metrics               map[string]string `json:"metrics,omitempty"`
+	Outputs               *JSONOutputFiles  `json:"outputs,omitempty"`
+}
+
+// JSONOutputFiles is the JSON form of repos.OutputFiles.
+type JSONOutputFiles struct {
+	Primary     string            `json:"primary,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+	Dirs        map[string]string `json:"dirs,omitempty"`
+	Generated   []string          `json:"generated,omitempty"`
+	ArtifactURL string            `json:"artifact-url,omitempty"`
+}
+
+// JSONEvent is the payload of JSONRecordEvent.
+type JSONEvent struct {
+	// Type is one of JSONEventXXX.
+	Type string `json:"type"`
+	// Task is the name of the task for task events.
+	Task string `json:"task,omitempty"`
+	// Worker is the index of the worker, only provided with JSONEventTaskStart.
+	Worker *int `json:"worker,omitempty"`
+	// Status is the result of the task for JSONEventTaskComplete.
+	Status     string `json:"status,omitempty"`
+	DurationMs int64  `json:"duration-ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// NumWorkers is provided with JSONEventBuildStart.
+	NumWorkers int `json:"workers,omitempty"`
+	// The following fields are progress of the build.
+	Completed int   `json:"completed"`
+	Total     int   `json:"total"`
+	Running   int   `json:"running,omitempty"`
+	ETAMs     int64 `json:"eta-ms,omitempty"`
+}
+
+type jsonEventPrinter struct {
+	printer   *JSONPrinter
+	startTime time.Time
+}
+
+// NewJSONPrinter creates a JSONPrinter writing to stdout.
+func NewJSONPrinter() *JSONPrinter {
+	return &JSONPrinter{encoder: json.NewEncoder(os.Stdout)}
+}
+
+// TaskEventHandler implements UserInterface.
+func (p *JSONPrinter) TaskEventHandler(options EventHandlingOptions) repos.EventHandler {
+	return &jsonEventPrinter{printer: p}
+}
+
+// PrintProjectList implements UserInterface.
+func (p *JSONPrinter) PrintProjectList(projects []*repos.Project) {
+	for _, project := range projects {
+		p.write(&JSONRecord{Type: JSONRecordProject, Project: &JSONProject{
+			Name:        project.Name,
+			Dir:         project.Dir,
+			Description: project.Meta().Description,
+		}})
+	}
+}
+
+// PrintProjectSummaryList implements UserInterface.
+func (p *JSONPrinter) PrintProjectSummaryList(summaries []*ProjectSummary) {
+	for _, summary := range summaries {
+		p.write(&JSONRecord{Type: JSONRecordProject, Project: &JSONProject{
+			Name:        summary.Project.Name,
+			Dir:         summary.Project.Dir,
+			Description: summary.Project.Meta().Description,
+			Summary:     summary,
+		}})
+	}
+}
+
+// PrintTargetList implements UserInterface.
+func (p *JSONPrinter) PrintTargetList(targets []*repos.Target) {
+	for _, target := range targets {
+		p.write(&JSONRecord{Type: JSONRecordTarget, Target: &JSONTarget{
+			Name:        target.Name.GlobalName(),
+			Tool:        target.ToolName(),
+			Description: target.Meta().Description,
+			Deps:        target.Meta().Deps,
+		}})
+	}
+}
+
+// PrintLog implements UserInterface.
+func (p *JSONPrinter) PrintLog(reader io.Reader) {
+	r := bufio.NewReader(reader)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			p.write(&JSONRecord{Type: JSONRecordLog, Log: strings.TrimRight(line, "\r\n")})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// PrintTaskStatus implements UserInterface.
+func (p *JSONPrinter) PrintTaskStatus(name string, result *repos.TaskResult, outputs *repos.OutputFiles) {
+	status := &JSONTaskStatus{Name: name, Status: JSONTaskStatusUnknown}
+	if result != nil {
+		switch {
+		case result.Skipped:
+			status.Status = TaskStatusSkipped
+		case result.Err != nil:
+			status.Status = TaskStatusFailed
+			status.Error = *result.Err
+		default:
+			status.Status = TaskStatusSucceeded
+		}
+		status.StartTime = formatJSONTime(result.StartTime)
+		status.EndTime = formatJSONTime(result.EndTime)
+		status.SuccessBuildStartTime = formatJSONTime(result.SuccessBuildStartTime)
+		status.SuccessBuildEndTime = formatJSONTime(result.SuccessBuildEndTime)
+		status.PeakRSS = result.PeakRSS
+		status.UserCPUMs = time.Duration(result.UserCPUNs).Milliseconds()
+		status.Metrics = result.Metrics
+	}
+	if outputs != nil {
+		status.Outputs = &JSONOutputFiles{
+			Primary:     outputs.Primary,
+			Extra:       outputs.Extra,
+			Dirs:        outputs.Dirs,
+			Generated:   outputs.GeneratedFiles,
+			ArtifactURL: outputs.ArtifactURL,
+		}
+	}
+	p.write(&JSONRecord{Type: JSONRecordTaskStatus, TaskStatus: status})
+}
+
+// PrintDependencyTree implements UserInterface.
+func (p *JSONPrinter) PrintDependencyTree(root *repos.Target, tree map[*repos.Target][]*repos.Target) {
+	// Nodes are collected in depth-first order, and the parent of a node
+	// is always the last node with smaller depth.
+	var stack []*JSONDepsNode
+	var rootNode JSONDepsNode
+	walkDependencyTree(root, tree, func(target *repos.Target, depth int, repeated bool) {
+		node := JSONDepsNode{Name: target.Name.GlobalName(), Repeated: repeated}
+		if depth == 0 {
+			rootNode = node
+			stack = []*JSONDepsNode{&rootNode}
+			return
+		}
+		parent := stack[depth-1]
+		parent.Deps = append(parent.Deps, node)
+		stack = append(stack[:depth], &parent.Deps[len(parent.Deps)-1])
+	})
+	p.write(&JSONRecord{Type: JSONRecordDepsTree, DepsTree: &rootNode})
+}
+
+// PrintBuildSummary implements UserInterface.
+func (p *JSONPrinter) PrintBuildSummary(summary *BuildSummary) {
+	p.write(&JSONRecord{Type: JSONRecordSummary, Summary: summary})
+}
+
+// PrintWarning implements UserInterface.
+func (p *JSONPrinter) PrintWarning(msg string) {
+	p.write(&JSONRecord{Type: JSONRecordWarning, Message: msg})
+}
+
+// PrintError implements UserInterface.
+func (p *JSONPrinter) PrintError(err error) {
+	p.write(&JSONRecord{Type: JSONRecordError, Message: err.Error()})
+}
+
+func (p *JSONPrinter) write(record *JSONRecord) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	record.Time = time.Now().Format(jsonPrinterTimeFormat)
+	p.encoder.Encode(record)
+}
+
+func (p *jsonEventPrinter) HandleEvent(ctx context.Context, event repos.DispatcherEvent) {
+	ev := &JSONEvent{
+		Completed: event.Graph().CompleteList.Len(),
+		Total:     len(event.Graph().Tasks),
+	}
+	switch e := event.(type) {
+	case *repos.DispatcherStartEvent:
+		ev.Type, ev.NumWorkers = JSONEventBuildStart, e.NumWorkers
+		p.startTime = time.Now()
+	case *repos.DispatcherEndEvent:
+		ev.Type = JSONEventBuildEnd
+		if e.Err != nil {
+			ev.Error = e.Err.Error()
+		}
+	case *repos.DispatcherProgressEvent:
+		ev.Type, ev.Running, ev.ETAMs = JSONEventProgress, e.Running, e.ETA.Milliseconds()
+	case *repos.TaskStartEvent:
+		worker := e.Worker
+		ev.Type, ev.Task, ev.Worker = JSONEventTaskStart, e.Task.Name(), &worker
+	case *repos.TaskCompleteEvent:
+		ev.Type, ev.Task = JSONEventTaskComplete, e.Task.Name()
+		switch {
+		case e.Task.Failed():
+			ev.Status, ev.Error = TaskStatusFailed, e.Task.Err.Error()
+		case e.Task.Skipped():
+			ev.Status = TaskStatusSkipped
+		default:
+			ev.Status = TaskStatusSucceeded
+		}
+		ev.DurationMs = e.Task.EndTime.Sub(e.Task.StartTime).Milliseconds()
+	default:
+		return
+	}
+	p.printer.write(&JSONRecord{Type: JSONRecordEvent, Event: ev})
+	if end, ok := event.(*repos.DispatcherEndEvent); ok {
+		summary := NewBuildSummary(event.Graph(), time.Since(p.startTime))
+		summary.Cache = end.CacheStats
+		p.printer.PrintBuildSummary(summary)
+	}
+}
+
+func formatJSONTime(nanos int64) string {
+	if nanos == 0 {
+		return ""
+	}
+	return time.Unix(0, nanos).Format(jsonPrinterTimeFormat)
+}
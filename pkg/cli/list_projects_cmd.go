@@ -2,11 +2,31 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"sort"
+
+	"repos/pkg/repos"
 )
 
 // ListProjectsCmd provides a command to list projects.
 type ListProjectsCmd struct {
+	// Verbose prints the summary of targets and last builds of each project.
+	Verbose bool
+}
+
+// ProjectSummary summarizes the targets and their last builds in a project.
+type ProjectSummary struct {
+	Project *repos.Project `json:"-"`
+	// Targets is the number of targets.
+	Targets int `json:"targets"`
+	// Succeeded is the number of targets whose last build succeeded or was skipped.
+	Succeeded int `json:"succeeded"`
+	// Failed is the number of targets whose last build failed.
+	Failed int `json:"failed"`
+	// NeverBuilt is the number of targets never built.
+	NeverBuilt int `json:"never-built"`
 }
 
 // Execute executes the command.
@@ -15,6 +35,39 @@ func (c *ListProjectsCmd) Execute(ctx context.Context, cctx *Context, args ...st
 	sort.Slice(projects, func(i, j int) bool {
 		return projects[i].Name < projects[j].Name
 	})
-	cctx.UI.PrintProjectList(projects)
+	if !c.Verbose {
+		cctx.UI.PrintProjectList(projects)
+		return nil
+	}
+	summaries := make([]*ProjectSummary, 0, len(projects))
+	for _, project := range projects {
+		summary, err := summarizeProject(cctx.Repo, project)
+		if err != nil {
+			return err
+		}
+		summaries = append(summaries, summary)
+	}
+	cctx.UI.PrintProjectSummaryList(summaries)
 	return nil
 }
+
+func summarizeProject(repo *repos.Repo, project *repos.Project) (*ProjectSummary, error) {
+	summary := &ProjectSummary{Project: project}
+	for _, target := range project.Targets() {
+		summary.Targets++
+		name := target.Name.GlobalName()
+		result, err := repo.LoadTaskResult(name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("load result of %q: %w", name, err)
+		}
+		switch {
+		case result == nil:
+			summary.NeverBuilt++
+		case !result.Skipped && result.Err != nil:
+			summary.Failed++
+		default:
+			summary.Succeeded++
+		}
+	}
+	return summary, nil
+}
@@ -2,7 +2,9 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"sort"
 
 	"repos/pkg/repos"
@@ -10,17 +12,34 @@ import (
 
 // ListTargetsCmd provides a command to list targets.
 type ListTargetsCmd struct {
+	// Tools filters targets using any of the tools.
+	// An empty tool name matches targets without a tool.
+	Tools []string
+	// NoTool filters targets without a tool, combined with Tools using OR.
+	NoTool bool
+	// Sort is one of TargetSortXXX, default is TargetSortName.
+	Sort string
 }
 
+// Values of ListTargetsCmd.Sort.
+const (
+	// TargetSortName sorts targets by project names and then local names.
+	TargetSortName = "name"
+	// TargetSortTool groups targets by tool names.
+	TargetSortTool = "tool"
+	// TargetSortStatus sorts targets by the results of last builds:
+	// failed, never built, skipped and then succeeded.
+	TargetSortStatus = "status"
+)
+
 // Execute executes the command.
 func (c *ListTargetsCmd) Execute(ctx context.Context, cctx *Context, args ...string) error {
 	targetSet := make(map[*repos.Target]struct{})
 	if len(args) == 0 {
-		for _, project := range cctx.Repo.Projects() {
-			for _, target := range project.Targets() {
-				targetSet[target] = struct{}{}
-			}
-		}
+		cctx.Repo.WalkTargets(func(target *repos.Target) error {
+			targetSet[target] = struct{}{}
+			return nil
+		})
 	} else {
 		for _, pattern := range args {
 			targets, err := cctx.Repo.ResolveTargets(pattern)
@@ -33,13 +52,88 @@ func (c *ListTargetsCmd) Execute(ctx context.Context, cctx *Context, args ...str
 		}
 	}
 
-	targets := make([]*repos.Target, 0, len(targetSet))
-	for target := range targetSet {
-		targets = append(targets, target)
+	var tools map[string]struct{}
+	if len(c.Tools) > 0 || c.NoTool {
+		tools = make(map[string]struct{})
+		for _, tool := range c.Tools {
+			tools[tool] = struct{}{}
+		}
+		if c.NoTool {
+			tools[""] = struct{}{}
+		}
 	}
-	sort.Slice(targets, func(i, j int) bool {
-		return targets[i].Name.GlobalName() < targets[j].Name.GlobalName()
+
+	projects := cctx.Repo.Projects()
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Name < projects[j].Name
 	})
+	targets := make([]*repos.Target, 0, len(targetSet))
+	for _, project := range projects {
+		for _, target := range project.TargetsSorted() {
+			if _, ok := targetSet[target]; !ok {
+				continue
+			}
+			if tools != nil {
+				if _, ok := tools[target.ToolName()]; !ok {
+					continue
+				}
+			}
+			targets = append(targets, target)
+		}
+	}
+	if err := c.sortTargets(cctx.Repo, targets); err != nil {
+		return err
+	}
 	cctx.UI.PrintTargetList(targets)
 	return nil
 }
+
+// sortTargets re-orders targets already sorted by project and local names.
+func (c *ListTargetsCmd) sortTargets(repo *repos.Repo, targets []*repos.Target) error {
+	switch c.Sort {
+	case "", TargetSortName:
+	case TargetSortTool:
+		sort.SliceStable(targets, func(i, j int) bool {
+			return targets[i].ToolName() < targets[j].ToolName()
+		})
+	case TargetSortStatus:
+		ranks := make(map[*repos.Target]int)
+		var loadErr error
+		rankOf := func(target *repos.Target) int {
+			rank, ok := ranks[target]
+			if !ok {
+				var err error
+				if rank, err = targetStatusRank(repo, target); err != nil && loadErr == nil {
+					loadErr = err
+				}
+				ranks[target] = rank
+			}
+			return rank
+		}
+		sort.SliceStable(targets, func(i, j int) bool {
+			return rankOf(targets[i]) < rankOf(targets[j])
+		})
+		return loadErr
+	default:
+		return fmt.Errorf("unknown sort %q, must be one of %s, %s, %s", c.Sort, TargetSortName, TargetSortTool, TargetSortStatus)
+	}
+	return nil
+}
+
+// targetStatusRank returns the order of the target when sorted by status.
+func targetStatusRank(repo *repos.Repo, target *repos.Target) (int, error) {
+	name := target.Name.GlobalName()
+	result, err := repo.LoadTaskResult(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return 1, nil
+	case err != nil:
+		return 0, fmt.Errorf("load result of %q: %w", name, err)
+	case result.Skipped:
+		return 2, nil
+	case result.Err != nil:
+		return 0, nil
+	default:
+		return 3, nil
+	}
+}
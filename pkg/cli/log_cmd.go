@@ -2,15 +2,33 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"repos/pkg/repos"
+	"time"
+)
+
+const (
+	followPollInterval = 200 * time.Millisecond
 )
 
 // LogCmd prints output of a task.
 type LogCmd struct {
+	// Internal prints the tool log instead of the output of the task.
+	Internal bool
+	// Follow builds the target and streams the log while building.
+	Follow bool
+	Build  BuildCmd
+}
+
+// followReader reads a growing file until done is closed.
+type followReader struct {
+	file     *os.File
+	done     <-chan struct{}
+	finished bool
 }
 
 // Execute executes the command.
@@ -31,7 +49,14 @@ func (c *LogCmd) Execute(ctx context.Context, cctx *Context, args ...string) err
 	if len(names) > 1 {
 		return fmt.Errorf("%q: matches multiple targets", args[0])
 	}
-	logFn := filepath.Join(cctx.Repo.LogDir(), names[0]+".out")
+	ext := ".out"
+	if c.Internal {
+		ext = ".log"
+	}
+	logFn := filepath.Join(cctx.Repo.LogDir(), names[0]+ext)
+	if c.Follow {
+		return c.buildAndFollow(ctx, cctx, names[0], logFn)
+	}
 	f, err := os.Open(logFn)
 	if err != nil {
 		return fmt.Errorf("open %q error: %w", logFn, err)
@@ -41,6 +66,65 @@ func (c *LogCmd) Execute(ctx context.Context, cctx *Context, args ...string) err
 	return nil
 }
 
+func (c *LogCmd) buildAndFollow(ctx context.Context, cctx *Context, name, logFn string) error {
+	// Remove the log from previous build, so the reader won't pick up stale content
+	// before the task recreates the file.
+	if err := os.Remove(logFn); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove %q error: %w", logFn, err)
+	}
+	done := make(chan struct{})
+	var buildErr error
+	build := c.Build
+	// Suppress the build progress which interferes with the streamed log.
+	build.eventHandler = repos.EventHandlerFunc(func(context.Context, repos.DispatcherEvent) {})
+	go func() {
+		defer close(done)
+		_, buildErr = build.Build(ctx, cctx, name)
+	}()
+
+	var f *os.File
+	for f == nil {
+		var err error
+		if f, err = os.Open(logFn); err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			<-done
+			return fmt.Errorf("open %q error: %w", logFn, err)
+		}
+		select {
+		case <-done:
+			if buildErr != nil {
+				return buildErr
+			}
+			return fmt.Errorf("%q: no log produced", name)
+		case <-time.After(followPollInterval):
+		}
+	}
+	defer f.Close()
+	cctx.UI.PrintLog(&followReader{file: f, done: done})
+	return buildErr
+}
+
+// Read implements io.Reader.
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if r.finished {
+			return 0, io.EOF
+		}
+		select {
+		case <-r.done:
+			// Read once more to pick up the remaining content.
+			r.finished = true
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
 // OpenTaskLog opens the task output file.
 func OpenTaskLog(task *repos.Task) (io.ReadCloser, error) {
 	return os.Open(filepath.Join(task.Graph.Repo.LogDir(), task.Name()+".out"))
@@ -6,15 +6,25 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"repos/pkg/repos"
 )
 
+// runKillTimeout is the duration to wait for the executable to exit
+// after a signal is forwarded before killing it.
+var runKillTimeout = 10 * time.Second
+
 // RunCmd executes the output executable from the specified target.
 type RunCmd struct {
 	Build BuildCmd
+	// Env specifies additional environment variables in the form KEY=VALUE.
+	// An entry without "=" inherits the value from the current environment.
+	Env []string
 }
 
 // Execute executes the command.
@@ -26,6 +36,8 @@ func (c *RunCmd) Execute(ctx context.Context, cctx *Context, args ...string) err
 	if err != nil {
 		return err
 	}
+	// The output directory is also needed for locating the executable.
+	defer c.Build.overrideOutputDir(cctx.Repo)()
 	g, err := c.Build.Build(ctx, cctx, target.Name.GlobalName())
 	if err != nil {
 		return err
@@ -64,7 +76,17 @@ func (c *RunCmd) Execute(ctx context.Context, cctx *Context, args ...string) err
 		}
 		cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+ldLibPath)
 	}
-	if err := cmd.Run(); err != nil {
+	for _, env := range c.Env {
+		if !strings.Contains(env, "=") {
+			val, ok := os.LookupEnv(env)
+			if !ok {
+				continue
+			}
+			env += "=" + val
+		}
+		cmd.Env = setEnv(cmd.Env, env)
+	}
+	if err := runForwardingSignals(cmd); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			os.Exit(exitErr.ExitCode())
 		}
@@ -73,6 +95,37 @@ func (c *RunCmd) Execute(ctx context.Context, cctx *Context, args ...string) err
 	return nil
 }
 
+// runForwardingSignals runs the command and forwards SIGINT/SIGTERM received
+// by the current process to it. The command is killed if it doesn't exit
+// within runKillTimeout after a signal is forwarded.
+func runForwardingSignals(cmd *exec.Cmd) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- cmd.Wait()
+	}()
+	var killCh <-chan time.Time
+	for {
+		select {
+		case err := <-doneCh:
+			return err
+		case sig := <-sigCh:
+			cmd.Process.Signal(sig)
+			if killCh == nil {
+				killCh = time.After(runKillTimeout)
+			}
+		case <-killCh:
+			cmd.Process.Kill()
+		}
+	}
+}
+
 func findSharedLibDirs(task *repos.Task, dirList *list.List, visited map[*repos.Task]struct{}) {
 	visited[task] = struct{}{}
 	for dep := range task.DepOn {
@@ -81,7 +134,19 @@ func findSharedLibDirs(task *repos.Task, dirList *list.List, visited map[*repos.
 		}
 		findSharedLibDirs(dep, dirList, visited)
 	}
-	if dir := task.Outputs.Extra["SHARED_LIB_DIR"]; dir != "" {
+	if dir := task.Outputs.Dirs["SHARED_LIB_DIR"]; dir != "" {
 		dirList.PushBack(filepath.Join(task.Target.Project.OutDir(), dir))
 	}
 }
+
+// setEnv sets env in the form KEY=VALUE in envs, replacing the existing value of KEY.
+func setEnv(envs []string, env string) []string {
+	prefix := env[:strings.Index(env, "=")+1]
+	for n, val := range envs {
+		if strings.HasPrefix(val, prefix) {
+			envs[n] = env
+			return envs
+		}
+	}
+	return append(envs, env)
+}
@@ -0,0 +1,101 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const helperProcessEnv = "REPOS_TEST_HELPER_PROCESS"
+
+// TestHelperProcess isn't a real test. It's the child process started by
+// runHelperProcess, which behaves according to the mode after "--".
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(helperProcessEnv) != "1" {
+		return
+	}
+	mode := os.Args[len(os.Args)-1]
+	sigCh := make(chan os.Signal, 1)
+	switch mode {
+	case "exit":
+		signal.Notify(sigCh, syscall.SIGTERM)
+	case "ignore":
+		signal.Ignore(syscall.SIGTERM)
+	}
+	fmt.Println("ready")
+	select {
+	case <-sigCh:
+		os.Exit(3)
+	case <-time.After(time.Minute):
+		os.Exit(0)
+	}
+}
+
+// runHelperProcess runs the helper process with runForwardingSignals and
+// sends SIGTERM to the current process once the helper is ready.
+func runHelperProcess(t *testing.T, mode string) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$", "--", mode)
+	cmd.Env = append(os.Environ(), helperProcessEnv+"=1")
+	cmd.Stdout, cmd.Stderr = w, os.Stderr
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- runForwardingSignals(cmd)
+	}()
+	// The signal handler is installed before the helper is started.
+	if _, err := bufio.NewReader(r).ReadString('\n'); err != nil {
+		t.Fatalf("read from helper process error: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(30 * time.Second):
+		t.Fatal("helper process didn't exit")
+	}
+	return nil
+}
+
+func TestRunForwardingSignalsExitStatus(t *testing.T) {
+	err := runHelperProcess(t, "exit")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expect exit error, got %v", err)
+	}
+	if code := exitErr.ExitCode(); code != 3 {
+		t.Errorf("expect exit code 3, got %d", code)
+	}
+}
+
+func TestRunForwardingSignalsKillAfterTimeout(t *testing.T) {
+	defer func(timeout time.Duration) {
+		runKillTimeout = timeout
+	}(runKillTimeout)
+	runKillTimeout = 100 * time.Millisecond
+
+	err := runHelperProcess(t, "ignore")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expect exit error, got %v", err)
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || status.Signal() != syscall.SIGKILL {
+		t.Errorf("expect killed by SIGKILL, got %v", exitErr)
+	}
+}
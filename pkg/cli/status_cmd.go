@@ -5,10 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
+
+	"repos/pkg/repos"
 )
 
 // StatusCmd prints status of a target.
 type StatusCmd struct {
+	// ExitCode returns ExitCodeError with code 1 if any target failed or
+	// has never been built, and code 2 if any target is not found.
+	ExitCode bool
 }
 
 // Execute executes the command.
@@ -16,20 +21,38 @@ func (c *StatusCmd) Execute(ctx context.Context, cctx *Context, args ...string)
 	if len(args) == 0 {
 		return nil
 	}
+	if c.ExitCode {
+		for _, pattern := range args {
+			if targets, err := cctx.Repo.ResolveTargets(pattern); err == nil && len(targets) == 0 {
+				return &ExitCodeError{Code: 2, Err: fmt.Errorf("%q: no target found", pattern)}
+			}
+		}
+	}
 	names, err := cctx.Repo.ResolveTargetNames(args...)
 	if err != nil {
 		return err
 	}
+	var failed int
 	for _, taskName := range names {
 		taskResult, err := cctx.Repo.LoadTaskResult(taskName)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
+		if errors.Is(err, repos.ErrCorrupt) {
+			cctx.UI.PrintWarning(fmt.Sprintf("ignore result of %q: %v", taskName, err))
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return fmt.Errorf("load result of %q: %w", taskName, err)
 		}
 		outputs, err := cctx.Repo.LoadTaskOutputs(taskName)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
+		if errors.Is(err, repos.ErrCorrupt) {
+			cctx.UI.PrintWarning(fmt.Sprintf("ignore outputs of %q: %v", taskName, err))
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
 			return fmt.Errorf("load outputs of %q: %w", taskName, err)
 		}
 		cctx.UI.PrintTaskStatus(taskName, taskResult, outputs)
+		if taskResult == nil || (!taskResult.Skipped && taskResult.Err != nil) {
+			failed++
+		}
+	}
+	if c.ExitCode && failed > 0 {
+		return &ExitCodeError{Code: 1, Err: fmt.Errorf("%d targets failed or never built", failed)}
 	}
 	return nil
 }
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"repos/pkg/repos"
+)
+
+// Values of TaskSummary.Status.
+const (
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusSkipped   = "skipped"
+	TaskStatusFailed    = "failed"
+	TaskStatusNotRun    = "not-run"
+)
+
+// BuildSummary is the summary of a build.
+type BuildSummary struct {
+	Total      int              `json:"total"`
+	Succeeded  int              `json:"succeeded"`
+	Skipped    int              `json:"skipped"`
+	Failed     int              `json:"failed"`
+	NotRun     int              `json:"not-run"`
+	DurationMs int64            `json:"duration-ms"`
+	Cache      repos.CacheStats `json:"cache"`
+	Tasks      []TaskSummary    `json:"tasks"`
+}
+
+// TaskSummary is the summary of a single task in the build.
+type TaskSummary struct {
+	Name       string   `json:"name"`
+	Status     string   `json:"status"`
+	DurationMs int64    `json:"duration-ms,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// NewBuildSummary creates BuildSummary from an executed TaskGraph.
+func NewBuildSummary(g *repos.TaskGraph, duration time.Duration) *BuildSummary {
+	s := &BuildSummary{
+		Total:      len(g.Tasks),
+		DurationMs: duration.Milliseconds(),
+		Tasks:      make([]TaskSummary, 0, len(g.Tasks)),
+	}
+	for name, task := range g.Tasks {
+		ts := TaskSummary{Name: name}
+		switch {
+		case task.State != repos.TaskCompleted:
+			ts.Status = TaskStatusNotRun
+			s.NotRun++
+		case task.Failed():
+			ts.Status = TaskStatusFailed
+			ts.Error = task.Err.Error()
+			s.Failed++
+		case task.Skipped():
+			ts.Status = TaskStatusSkipped
+			s.Skipped++
+		default:
+			ts.Status = TaskStatusSucceeded
+			s.Succeeded++
+		}
+		if task.State == repos.TaskCompleted {
+			ts.DurationMs = task.EndTime.Sub(task.StartTime).Milliseconds()
+			ts.Warnings = task.Warnings
+		}
+		s.Tasks = append(s.Tasks, ts)
+	}
+	sort.Slice(s.Tasks, func(i, j int) bool {
+		return s.Tasks[i].Name < s.Tasks[j].Name
+	})
+	return s
+}
+
+// Duration returns the duration of the build.
+func (s *BuildSummary) Duration() time.Duration {
+	return time.Duration(s.DurationMs) * time.Millisecond
+}
+
+// WriteFile writes the summary as JSON to the file.
+func (s *BuildSummary) WriteFile(fn string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fn, data, 0644)
+}
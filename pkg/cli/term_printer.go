@@ -8,18 +8,27 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/term"
+
 	"repos/pkg/repos"
 )
 
+// defaultProgressBarWidth is the width of progress bar when
+// the terminal width is unknown.
+const defaultProgressBarWidth = 20
+
 // TermPrinter provides an output-only UserInterface for ANSI terminal.
 type TermPrinter struct {
 }
 
 // TaskEventHandler implements UserInterface.
 func (p *TermPrinter) TaskEventHandler(options EventHandlingOptions) repos.EventHandler {
-	return newTasksPrinter(os.Stdout, options.LogReader)
+	printer := newTasksPrinter(os.Stdout, options.LogReader)
+	printer.verbose = options.Verbose
+	return printer
 }
 
 // PrintProjectList prints project list.
@@ -35,6 +44,23 @@ func (p *TermPrinter) PrintProjectList(projects []*repos.Project) {
 	}
 }
 
+// PrintProjectSummaryList prints projects with summaries of targets.
+func (p *TermPrinter) PrintProjectSummaryList(summaries []*ProjectSummary) {
+	var width int
+	for _, summary := range summaries {
+		if w := len(summary.Project.Name) + len(summary.Project.Dir) + 3; w > width {
+			width = w
+		}
+	}
+	for _, summary := range summaries {
+		project := summary.Project
+		padding := strings.Repeat(" ", width-len(project.Name)-len(project.Dir)-3)
+		fmt.Printf("\x1b[36;1m%s\x1b[m \x1b[37m[%s]\x1b[m%s", project.Name, project.Dir, padding)
+		fmt.Printf(" \x1b[37;1m%4d\x1b[m targets \x1b[32;1m%4d\x1b[m ok \x1b[31;1m%4d\x1b[m failed \x1b[33;1m%4d\x1b[m never built\n",
+			summary.Targets, summary.Succeeded, summary.Failed, summary.NeverBuilt)
+	}
+}
+
 // PrintTargetList prints target list.
 func (p *TermPrinter) PrintTargetList(targets []*repos.Target) {
 	for _, target := range targets {
@@ -78,9 +104,19 @@ func (p *TermPrinter) PrintTaskStatus(name string, result *repos.TaskResult, out
 		fmt.Println("Last build:")
 		fmt.Printf("  StartAt: %s\n", time.Unix(0, result.StartTime).Format(time.StampMilli))
 		fmt.Printf("  EndAt:   %s\n", time.Unix(0, result.EndTime).Format(time.StampMilli))
+		if result.PeakRSS != 0 || result.UserCPUNs != 0 {
+			fmt.Printf("  PeakRSS: \x1b[35m%s\x1b[m\n", formatBytes(result.PeakRSS))
+			fmt.Printf("  UserCPU: \x1b[35m%s\x1b[m\n", time.Duration(result.UserCPUNs).Truncate(time.Millisecond))
+		}
 		if !result.Skipped && result.Err != nil {
 			fmt.Printf("  \x1b[31;1mError:\x1b[m \x1b[31m%s\x1b[m\n", *result.Err)
 		}
+		if len(result.Metrics) > 0 {
+			fmt.Printf("  Metrics:\n")
+			for _, key := range sortedKeys(result.Metrics) {
+				fmt.Printf("    \x1b[34m%s\x1b[m: \x1b[37;1m%s\x1b[m\n", key, result.Metrics[key])
+			}
+		}
 	}
 
 	if outputs == nil {
@@ -96,12 +132,46 @@ func (p *TermPrinter) PrintTaskStatus(name string, result *repos.TaskResult, out
 			fmt.Printf("    \x1b[34m%s\x1b[m: %s\n", key, val)
 		}
 	}
+	if len(outputs.Dirs) > 0 {
+		fmt.Printf("  Dirs:\n")
+		for key, val := range outputs.Dirs {
+			fmt.Printf("    \x1b[34m%s\x1b[m: %s\n", key, val)
+		}
+	}
 	if len(outputs.GeneratedFiles) > 0 {
 		fmt.Printf("  Generated:\n")
 		for _, fn := range outputs.GeneratedFiles {
 			fmt.Printf("    \x1b[33m%s\x1b[m\n", fn)
 		}
 	}
+	if outputs.ArtifactURL != "" {
+		fmt.Printf("  ArtifactURL: \x1b[36;1m%s\x1b[m\n", outputs.ArtifactURL)
+	}
+}
+
+// PrintDependencyTree implements UserInterface.
+func (p *TermPrinter) PrintDependencyTree(root *repos.Target, tree map[*repos.Target][]*repos.Target) {
+	walkDependencyTree(root, tree, func(target *repos.Target, depth int, repeated bool) {
+		var indent string
+		if depth > 0 {
+			indent = strings.Repeat("  ", depth-1) + "\x1b[37m└─\x1b[m "
+		}
+		var suffix string
+		if repeated {
+			suffix = " \x1b[37m(*)\x1b[m"
+		}
+		fmt.Printf("%s\x1b[36;1m%s\x1b[m%s\n", indent, target.Name.GlobalName(), suffix)
+	})
+}
+
+// PrintBuildSummary implements UserInterface.
+func (p *TermPrinter) PrintBuildSummary(summary *BuildSummary) {
+	printBuildSummaryBox(os.Stdout, summary)
+}
+
+// PrintWarning implements UserInterface.
+func (p *TermPrinter) PrintWarning(msg string) {
+	fmt.Fprintf(os.Stderr, "\x1b[33;1mWarning:\x1b[m \x1b[33m%s.\x1b[m\n", msg)
 }
 
 // PrintError implements UserInterface.
@@ -110,13 +180,26 @@ func (p *TermPrinter) PrintError(err error) {
 }
 
 type tasksPrinter struct {
-	succeeded   int
-	skipped     int
-	failed      int
 	logReader   TaskLogReader
 	writer      io.Writer
 	tasks       map[*repos.Task]int
 	currentRows int
+	eta         time.Duration
+	startTime   time.Time
+	// verbose streams the output of running tasks.
+	verbose bool
+	// state is the last rendered state row.
+	state   string
+	outputs map[*repos.Task]*taskOutputWriter
+	// lock protects the terminal from concurrent output of tasks.
+	lock sync.Mutex
+}
+
+// taskOutputWriter forwards the output of a task line by line to tasksPrinter.
+type taskOutputWriter struct {
+	printer *tasksPrinter
+	task    *repos.Task
+	buf     []byte
 }
 
 func newTasksPrinter(w io.Writer, logReader TaskLogReader) *tasksPrinter {
@@ -124,32 +207,44 @@ func newTasksPrinter(w io.Writer, logReader TaskLogReader) *tasksPrinter {
 		writer:    w,
 		logReader: logReader,
 		tasks:     make(map[*repos.Task]int),
+		outputs:   make(map[*repos.Task]*taskOutputWriter),
 	}
 	return p
 }
 
+// TaskOutput implements TaskOutputHandler.
+func (p *tasksPrinter) TaskOutput(task *repos.Task) io.Writer {
+	if !p.verbose {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	w := &taskOutputWriter{printer: p, task: task}
+	p.outputs[task] = w
+	return w
+}
+
 func (p *tasksPrinter) HandleEvent(ctx context.Context, event repos.DispatcherEvent) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	total := len(event.Graph().Tasks)
 	completed := event.Graph().CompleteList.Len()
 	percentage := float32(completed) * 100 / float32(total)
 	switch ev := event.(type) {
 	case *repos.DispatcherStartEvent:
-		p.succeeded = 0
-		p.skipped = 0
-		p.failed = 0
+		p.eta = 0
+		p.startTime = time.Now()
 	case *repos.DispatcherEndEvent:
-		p.complete(p.succeeded, p.skipped, p.failed, total-completed)
+		summary := NewBuildSummary(event.Graph(), time.Since(p.startTime))
+		summary.Cache = ev.CacheStats
+		p.complete(summary)
+	case *repos.DispatcherProgressEvent:
+		p.eta = ev.ETA
+		p.moveToStart()
+		p.renderRows(p.progressState(percentage))
 	case *repos.TaskStartEvent:
 		p.taskStart(ev.Task, ev.Worker, percentage)
 	case *repos.TaskCompleteEvent:
-		switch {
-		case ev.Task.Failed():
-			p.failed++
-		case ev.Task.Skipped():
-			p.skipped++
-		default:
-			p.succeeded++
-		}
 		p.taskComplete(ev.Task, percentage)
 	}
 }
@@ -157,15 +252,23 @@ func (p *tasksPrinter) HandleEvent(ctx context.Context, event repos.DispatcherEv
 func (p *tasksPrinter) taskStart(task *repos.Task, worker int, percentage float32) {
 	p.tasks[task] = worker
 	p.moveToStart()
-	p.renderRows(percentageState(percentage))
+	p.renderRows(p.progressState(percentage))
 }
 
 func (p *tasksPrinter) taskComplete(task *repos.Task, percentage float32) {
 	delete(p.tasks, task)
+	if w := p.outputs[task]; w != nil {
+		w.flush()
+		delete(p.outputs, task)
+	}
 	var linePrefix, dur string
 	switch {
+	case task.FailedWithTimeout():
+		linePrefix = "\x1b[31;1m⏱ "
+	case task.FailedWithCancel():
+		linePrefix = "\x1b[33;1m⊘ "
 	case task.Failed():
-		linePrefix = "\x1b[31;1m:("
+		linePrefix = "\x1b[31;1m✗ "
 	case task.Skipped():
 		linePrefix = "\x1b[36;1m:]"
 	default:
@@ -174,8 +277,22 @@ func (p *tasksPrinter) taskComplete(task *repos.Task, percentage float32) {
 	if !task.Skipped() {
 		dur = fmt.Sprintf(" \x1b[35;1m%s\x1b[m", task.EndTime.Sub(task.StartTime).Truncate(time.Millisecond))
 	}
+	p.printAboveRows(fmt.Sprintf("%s\x1b[m \x1b[37m%s\x1b[m%s", linePrefix, task.Name(), dur))
+	if task.Failed() {
+		p.printf("    \x1b[31m%v\x1b[m\n", task.Err)
+		// The output has been displayed in verbose mode.
+		if !p.verbose {
+			p.printTaskLog(task)
+		}
+	}
+	p.renderRows(p.progressState(percentage))
+}
+
+// printAboveRows prints a line in place of the rows of running tasks.
+// The rows must be rendered again afterwards.
+func (p *tasksPrinter) printAboveRows(line string) {
 	p.moveToStart()
-	p.printf("\x1b[2K\r%s\x1b[m \x1b[37m%s\x1b[m%s\n", linePrefix, task.Name(), dur)
+	p.printf("\x1b[2K\r%s\n", line)
 	for i := 1; i < p.currentRows; i++ {
 		p.printf("\x1b[2K\n")
 	}
@@ -183,29 +300,24 @@ func (p *tasksPrinter) taskComplete(task *repos.Task, percentage float32) {
 		p.printf("\x1b[%dA", p.currentRows-1)
 	}
 	p.currentRows = 0
-	if task.Failed() {
-		p.printf("    \x1b[31m%v\x1b[m\n", task.Err)
-		p.printTaskLog(task)
-	}
-	p.renderRows(percentageState(percentage))
 }
 
-func (p *tasksPrinter) complete(succeeded, skipped, failed, incomplete int) {
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "\x1b[32mOK\x1b[m \x1b[32;1m%d\x1b[m", succeeded)
-	if skipped != 0 {
-		fmt.Fprintf(&buf, " \x1b[36mSkipped\x1b[m \x1b[36;1m%d\x1b[m", skipped)
-	}
-	if failed != 0 {
-		fmt.Fprintf(&buf, " \x1b[31mFailed\x1b[m \x1b[31;1m%d\x1b[m", failed)
-	}
-	if incomplete != 0 {
-		fmt.Fprintf(&buf, " \x1b[37;0mNotRun\x1b[m \x1b[37m%d\x1b[m", incomplete)
-	}
+func (p *tasksPrinter) printTaskOutput(task *repos.Task, line string) {
+	p.printAboveRows(fmt.Sprintf("\x1b[36m%s\x1b[m %s", task.Name(), line))
+	p.renderRows(p.state)
+}
+
+func (p *tasksPrinter) complete(summary *BuildSummary) {
 	p.tasks = nil
 	p.moveToStart()
-	p.renderRows(buf.String())
-	p.printf("\n")
+	p.renderRows("")
+	printBuildSummaryBox(p.writer, summary)
+	printBuildResult(summary)
+	for _, task := range summary.Tasks {
+		for _, msg := range task.Warnings {
+			p.printf("\x1b[33;1mWarning:\x1b[m \x1b[36m%s\x1b[m \x1b[33m%s\x1b[m\n", task.Name, msg)
+		}
+	}
 }
 
 func (p *tasksPrinter) moveToStart() {
@@ -228,7 +340,9 @@ func (p *tasksPrinter) renderRows(state string) {
 	}
 	sort.Ints(slots)
 	for _, w := range slots {
-		p.printf("\x1b[2K\r\x1b[5m\x1b[32m>>\x1b[m \x1b[36m%2d\x1b[m \x1b[37m%s\x1b[m\n", w, workers[w].Name())
+		task := workers[w]
+		p.printf("\x1b[2K\r\x1b[5m\x1b[32m>>\x1b[m \x1b[36m%2d\x1b[m \x1b[37m%s\x1b[m \x1b[35m%s\x1b[m\n",
+			w, task.Name(), time.Since(task.StartTime).Truncate(time.Second))
 	}
 	for i := len(slots); i < p.currentRows; i++ {
 		p.printf("\x1b[2K\n")
@@ -237,9 +351,34 @@ func (p *tasksPrinter) renderRows(state string) {
 		p.printf("\x1b[%dA", p.currentRows-len(slots))
 	}
 	p.currentRows = len(slots)
+	p.state = state
 	p.printf("\x1b[2K\r%s", state)
 }
 
+func (p *tasksPrinter) progressState(percentage float32) string {
+	var eta string
+	if p.eta > 0 {
+		eta = p.eta.Truncate(time.Second).String()
+	}
+	barWidth := defaultProgressBarWidth
+	if width := terminalWidth(p.writer); width > 0 {
+		// Reserve space for the percentage, brackets, ETA and
+		// one trailing column to avoid line wrapping.
+		reserved := len("100.0% [] ")
+		if eta != "" {
+			reserved += len(" ETA ") + len(eta)
+		}
+		if barWidth = width - reserved; barWidth < 0 {
+			barWidth = 0
+		}
+	}
+	state := percentageState(percentage, barWidth)
+	if eta != "" {
+		state += fmt.Sprintf(" ETA \x1b[35m%s\x1b[m", eta)
+	}
+	return state
+}
+
 func (p *tasksPrinter) printf(format string, args ...interface{}) {
 	fmt.Fprintf(p.writer, format, args...)
 }
@@ -259,14 +398,94 @@ func (p *tasksPrinter) printTaskLog(task *repos.Task) {
 	p.printf("\n")
 }
 
-func percentageState(percentage float32) string {
+// Write implements io.Writer.
+func (w *taskOutputWriter) Write(data []byte) (int, error) {
+	w.printer.lock.Lock()
+	defer w.printer.lock.Unlock()
+	w.buf = append(w.buf, data...)
+	for {
+		pos := bytes.IndexByte(w.buf, '\n')
+		if pos < 0 {
+			break
+		}
+		w.printer.printTaskOutput(w.task, string(w.buf[:pos]))
+		w.buf = w.buf[pos+1:]
+	}
+	return len(data), nil
+}
+
+// flush prints the incomplete last line. The printer must be locked.
+func (w *taskOutputWriter) flush() {
+	if len(w.buf) > 0 {
+		w.printer.printTaskOutput(w.task, string(w.buf))
+		w.buf = nil
+	}
+}
+
+func printBuildSummaryBox(w io.Writer, summary *BuildSummary) {
+	rows := []struct {
+		label, value, color string
+	}{
+		{"Total", fmt.Sprint(summary.Total), "37;1"},
+		{"OK", fmt.Sprint(summary.Succeeded), "32;1"},
+		{"Skipped", fmt.Sprint(summary.Skipped), "36;1"},
+		{"Failed", fmt.Sprint(summary.Failed), "31;1"},
+		{"NotRun", fmt.Sprint(summary.NotRun), "37"},
+		{"CacheHit", fmt.Sprint(summary.Cache.Hits), "32"},
+		{"CacheMiss", fmt.Sprint(summary.Cache.Misses), "33"},
+		{"CacheErr", fmt.Sprint(summary.Cache.Errors), "31"},
+		{"Duration", summary.Duration().String(), "35;1"},
+	}
+	const labelWidth = 10
+	valueWidth := 0
+	for _, row := range rows {
+		if len(row.value) > valueWidth {
+			valueWidth = len(row.value)
+		}
+	}
+	border := strings.Repeat("─", labelWidth+valueWidth+2)
+	fmt.Fprintf(w, "\x1b[37m┌%s┐\x1b[m\n", border)
+	for _, row := range rows {
+		fmt.Fprintf(w, "\x1b[37m│\x1b[m %-*s\x1b[%sm%*s\x1b[m \x1b[37m│\x1b[m\n", labelWidth, row.label, row.color, valueWidth, row.value)
+	}
+	fmt.Fprintf(w, "\x1b[37m└%s┘\x1b[m\n", border)
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// terminalWidth returns the width of the terminal the writer is attached to.
+// It returns 0 if the writer is not a terminal.
+func terminalWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+func percentageState(percentage float32, barWidth int) string {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "%.1f%% [", percentage)
-	blocks := int(percentage * 20 / 100)
+	blocks := int(percentage * float32(barWidth) / 100)
 	for i := 0; i < blocks; i++ {
 		fmt.Fprintf(&buf, "=")
 	}
-	for i := blocks; i < 20; i++ {
+	for i := blocks; i < barWidth; i++ {
 		fmt.Fprintf(&buf, " ")
 	}
 	fmt.Fprintf(&buf, "]")
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"repos/pkg/repos"
@@ -26,6 +28,14 @@ func (p *TextPrinter) PrintProjectList(projects []*repos.Project) {
 	}
 }
 
+// PrintProjectSummaryList prints projects with summaries of targets.
+func (p *TextPrinter) PrintProjectSummaryList(summaries []*ProjectSummary) {
+	for _, summary := range summaries {
+		fmt.Printf("%s %s targets=%d succeeded=%d failed=%d never-built=%d\n",
+			summary.Project.Name, summary.Project.Dir, summary.Targets, summary.Succeeded, summary.Failed, summary.NeverBuilt)
+	}
+}
+
 // PrintTargetList prints target list.
 func (p *TextPrinter) PrintTargetList(targets []*repos.Target) {
 	for _, target := range targets {
@@ -52,6 +62,10 @@ func (p *TextPrinter) PrintTaskStatus(name string, result *repos.TaskResult, out
 		fmt.Println("Last build:")
 		fmt.Printf("  StartAt: %s\n", time.Unix(0, result.StartTime))
 		fmt.Printf("  EndAt: %s\n", time.Unix(0, result.EndTime))
+		if result.PeakRSS != 0 || result.UserCPUNs != 0 {
+			fmt.Printf("  PeakRSS: %d\n", result.PeakRSS)
+			fmt.Printf("  UserCPU: %s\n", time.Duration(result.UserCPUNs))
+		}
 		switch {
 		case result.Skipped:
 			fmt.Printf("  Result: Skipped\n")
@@ -61,6 +75,12 @@ func (p *TextPrinter) PrintTaskStatus(name string, result *repos.TaskResult, out
 			fmt.Printf("  Result: Failed\n")
 			fmt.Printf("  Error: %s\n", *result.Err)
 		}
+		if len(result.Metrics) > 0 {
+			fmt.Printf("  Metrics:\n")
+			for _, key := range sortedKeys(result.Metrics) {
+				fmt.Printf("    %s: %s\n", key, result.Metrics[key])
+			}
+		}
 	}
 
 	if outputs == nil {
@@ -74,12 +94,42 @@ func (p *TextPrinter) PrintTaskStatus(name string, result *repos.TaskResult, out
 			fmt.Printf("    %s: %s\n", key, val)
 		}
 	}
+	if len(outputs.Dirs) > 0 {
+		fmt.Printf("  Dirs:\n")
+		for key, val := range outputs.Dirs {
+			fmt.Printf("    %s: %s\n", key, val)
+		}
+	}
 	if len(outputs.GeneratedFiles) > 0 {
 		fmt.Printf("  Generated:\n")
 		for _, fn := range outputs.GeneratedFiles {
 			fmt.Printf("    %s\n", fn)
 		}
 	}
+	if outputs.ArtifactURL != "" {
+		fmt.Printf("  ArtifactURL: %s\n", outputs.ArtifactURL)
+	}
+}
+
+// PrintDependencyTree implements UserInterface.
+func (p *TextPrinter) PrintDependencyTree(root *repos.Target, tree map[*repos.Target][]*repos.Target) {
+	walkDependencyTree(root, tree, func(target *repos.Target, depth int, repeated bool) {
+		var suffix string
+		if repeated {
+			suffix = " (*)"
+		}
+		fmt.Printf("%s%s%s\n", strings.Repeat("  ", depth), target.Name.GlobalName(), suffix)
+	})
+}
+
+// PrintBuildSummary implements UserInterface.
+func (p *TextPrinter) PrintBuildSummary(summary *BuildSummary) {
+	fmt.Printf("SUMMARY %s\n", formatBuildSummaryText(summary))
+}
+
+// PrintWarning implements UserInterface.
+func (p *TextPrinter) PrintWarning(msg string) {
+	fmt.Fprintf(os.Stderr, "Warning: %s.\n", msg)
 }
 
 // PrintError implements UserInterface.
@@ -92,6 +142,7 @@ type textEventPrinter struct {
 	skipped   int
 	failed    int
 	logReader TaskLogReader
+	startTime time.Time
 }
 
 func (p *textEventPrinter) HandleEvent(ctx context.Context, event repos.DispatcherEvent) {
@@ -103,28 +154,41 @@ func (p *textEventPrinter) HandleEvent(ctx context.Context, event repos.Dispatch
 		p.succeeded = 0
 		p.skipped = 0
 		p.failed = 0
-		fmt.Printf("BUILD START workers=%d tasks=%d\n", ev.NumWorkers, total)
+		p.startTime = time.Now()
+		p.printf("BUILD START workers=%d tasks=%d\n", ev.NumWorkers, total)
 	case *repos.DispatcherEndEvent:
-		fmt.Printf("BUILD END succeeded=%d skipped=%d failed=%d\n", p.succeeded, p.skipped, p.failed)
+		p.printf("BUILD END succeeded=%d skipped=%d failed=%d\n", p.succeeded, p.skipped, p.failed)
+		summary := NewBuildSummary(event.Graph(), time.Since(p.startTime))
+		summary.Cache = ev.CacheStats
+		p.printf("SUMMARY %s\n", formatBuildSummaryText(summary))
+		printBuildResult(summary)
+	case *repos.DispatcherProgressEvent:
+		p.printf("%s PROGRESS completed=%d/%d running=%d eta=%s\n",
+			percentage, ev.Completed, ev.Total, ev.Running, ev.ETA.Truncate(time.Second))
 	case *repos.TaskStartEvent:
-		fmt.Printf("%s START %s worker=%d\n", percentage, ev.Task.Name(), ev.Worker)
+		p.printf("%s START %s worker=%d\n", percentage, ev.Task.Name(), ev.Worker)
 	case *repos.TaskCompleteEvent:
 		if ev.Task.Failed() {
 			p.failed++
-			fmt.Printf("%s FAILED %s: %v\n", percentage, ev.Task.Name(), ev.Task.Err)
+			p.printf("%s FAILED %s: %v\n", percentage, ev.Task.Name(), ev.Task.Err)
 			p.printTaskLog(ev.Task)
 			return
 		}
 		if ev.Task.Skipped() {
 			p.skipped++
-			fmt.Printf("%s SKIPPED %s\n", percentage, ev.Task.Name())
+			p.printf("%s SKIPPED %s\n", percentage, ev.Task.Name())
 			return
 		}
 		p.succeeded++
-		fmt.Printf("%s DONE %s\n", percentage, ev.Task.Name())
+		p.printf("%s DONE %s\n", percentage, ev.Task.Name())
 	}
 }
 
+// printf prints an event line prefixed by the timestamp.
+func (p *textEventPrinter) printf(format string, args ...interface{}) {
+	fmt.Printf(time.Now().Format(time.RFC3339)+" "+format, args...)
+}
+
 func (p *textEventPrinter) printTaskLog(task *repos.Task) {
 	if p.logReader == nil {
 		return
@@ -139,3 +203,24 @@ func (p *textEventPrinter) printTaskLog(task *repos.Task) {
 	io.Copy(os.Stderr, reader)
 	fmt.Fprintln(os.Stderr, "")
 }
+
+func formatBuildSummaryText(summary *BuildSummary) string {
+	return fmt.Sprintf("total=%d succeeded=%d skipped=%d failed=%d not-run=%d cache-hits=%d cache-misses=%d cache-errors=%d duration=%s",
+		summary.Total, summary.Succeeded, summary.Skipped, summary.Failed, summary.NotRun,
+		summary.Cache.Hits, summary.Cache.Misses, summary.Cache.Errors, summary.Duration())
+}
+
+// printBuildResult writes the numbers of rebuilt, skipped and failed tasks
+// to stderr, so it doesn't mix with the output of the build.
+func printBuildResult(summary *BuildSummary) {
+	fmt.Fprintf(os.Stderr, "Rebuilt: %d Skipped: %d Failed: %d\n", summary.Succeeded, summary.Skipped, summary.Failed)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -20,11 +20,23 @@ type Cache interface {
 	// AddSource is similar to AddInput but relPath is relative to source dir.
 	AddSource(relPath string, recursive bool) error
 
+	// AddInputGlob expands pattern using filepath.Glob and adds each matched
+	// entry using AddInput.
+	AddInputGlob(pattern string, recursive bool) error
+
+	// AddSourceGlob is similar to AddInputGlob but pattern is relative to source dir.
+	AddSourceGlob(pattern string, recursive bool) error
+
 	// AddOutput adds output file/directory generated by the task.
 	// If it's a directory, relPath must be suffixed by "/".
 	// If key is empty, it's primary output.
 	AddOutput(key, relPath string)
 
+	// AddOutputDir adds output directory generated by the task.
+	// relPath doesn't need to be suffixed by "/".
+	// If key is empty, it's primary output, otherwise it's in OutputFiles.Dirs.
+	AddOutputDir(key, relPath string)
+
 	// AddGenerated adds generated file/directory by the task.
 	// If it's a directory, relPath must be suffixed by "/".
 	AddGenerated(relPath string)
@@ -32,6 +44,9 @@ type Cache interface {
 	// AddOpaque add opaque data.
 	AddOpaque(opaque ...string)
 
+	// SetArtifactURL records the URL of the remote artifact.
+	SetArtifactURL(url string)
+
 	// Load loads previously saved state.
 	Load() error
 
@@ -97,6 +112,24 @@ func (r *CacheReporter) AddSourceRecursively(relPath string) error {
 	return r.addSource(relPath, true)
 }
 
+// AddInputGlob adds input entries matched by pattern.
+func (r *CacheReporter) AddInputGlob(pattern string, recursive bool) error {
+	if err := r.Cache.AddInputGlob(pattern, recursive); err != nil {
+		return err
+	}
+	r.records = append(r.records, func(c Cache) error { return c.AddInputGlob(pattern, recursive) })
+	return nil
+}
+
+// AddSourceGlob is similar to AddInputGlob but pattern is relative to source dir.
+func (r *CacheReporter) AddSourceGlob(pattern string, recursive bool) error {
+	if err := r.Cache.AddSourceGlob(pattern, recursive); err != nil {
+		return err
+	}
+	r.records = append(r.records, func(c Cache) error { return c.AddSourceGlob(pattern, recursive) })
+	return nil
+}
+
 func (r *CacheReporter) AddOutput(key, relPath string) {
 	r.Cache.AddOutput(key, relPath)
 	r.records = append(r.records, func(c Cache) error {
@@ -108,7 +141,11 @@ func (r *CacheReporter) AddOutput(key, relPath string) {
 // AddOutputDir explicitly adds an output directory without requiring
 // relPath suffixed by "/".
 func (r *CacheReporter) AddOutputDir(key, relPath string) {
-	r.AddOutput(key, strings.TrimRight(relPath, pathSep)+pathSep)
+	r.Cache.AddOutputDir(key, relPath)
+	r.records = append(r.records, func(c Cache) error {
+		c.AddOutputDir(key, relPath)
+		return nil
+	})
 }
 
 func (r *CacheReporter) AddGenerated(relPath string) {
@@ -134,6 +171,15 @@ func (r *CacheReporter) AddOpaque(opaque ...string) {
 	})
 }
 
+// SetArtifactURL records the URL of the remote artifact.
+func (r *CacheReporter) SetArtifactURL(url string) {
+	r.Cache.SetArtifactURL(url)
+	r.records = append(r.records, func(c Cache) error {
+		c.SetArtifactURL(url)
+		return nil
+	})
+}
+
 // Replay replays the recorded reports to the specified cache.
 func (r *CacheReporter) Replay(c Cache) error {
 	for _, rec := range r.records {
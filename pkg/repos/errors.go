@@ -1,6 +1,9 @@
 package repos
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrSkipped is used as the return value of ToolExecutor.Execute
@@ -11,6 +14,8 @@ var (
 	ErrSomeTaskFailed = errors.New("some task failed")
 	// ErrIncomplete indicates not all tasks are completed.
 	ErrIncomplete = errors.New("incomplete")
+	// ErrCorrupt indicates a state or result file can't be parsed.
+	ErrCorrupt = errors.New("corrupt state file")
 	// ErrTooManyTools indicates more than one tool is specified in target.rule.
 	ErrTooManyTools = errors.New("only one tool can be specified in rule")
 
@@ -19,3 +24,26 @@ var (
 	// ErrAmbiguousMatch indicates more than one names are matched.
 	ErrAmbiguousMatch = errors.New("ambiguous match")
 )
+
+// interruptedError is the error of a task interrupted by the cancellation of
+// the context. It unwraps to the error of the tool, and matches the error of
+// the context with errors.Is.
+type interruptedError struct {
+	err    error
+	ctxErr error
+}
+
+// Error implements error.
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("%v: %v", e.err, e.ctxErr)
+}
+
+// Unwrap returns the error of the tool.
+func (e *interruptedError) Unwrap() error {
+	return e.err
+}
+
+// Is matches the error of the context.
+func (e *interruptedError) Is(target error) bool {
+	return errors.Is(e.ctxErr, target)
+}
@@ -0,0 +1,23 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestInterruptedErrorMatchesBothErrors(t *testing.T) {
+	toolErr := exec.Command("false").Run()
+	err := error(&interruptedError{err: toolErr, ctxErr: context.Canceled})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expect %v to match context.Canceled", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("expect %v to match *exec.ExitError", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect %v not to match context.DeadlineExceeded", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -13,6 +14,10 @@ import (
 	"time"
 )
 
+const (
+	defaultProgressInterval = 5 * time.Second
+)
+
 // EventHandler handles events from Dispatcher.Run.
 type EventHandler interface {
 	HandleEvent(ctx context.Context, event DispatcherEvent)
@@ -26,6 +31,42 @@ func (f EventHandlerFunc) HandleEvent(ctx context.Context, event DispatcherEvent
 	f(ctx, event)
 }
 
+// MultiEventHandler fans out events to multiple handlers.
+type MultiEventHandler []EventHandler
+
+// NewMultiEventHandler creates a MultiEventHandler.
+func NewMultiEventHandler(handlers ...EventHandler) *MultiEventHandler {
+	h := MultiEventHandler(handlers)
+	return &h
+}
+
+// HandleEvent implements EventHandler.
+// The event is passed to each handler in order.
+func (h MultiEventHandler) HandleEvent(ctx context.Context, event DispatcherEvent) {
+	for _, handler := range h {
+		handler.HandleEvent(ctx, event)
+	}
+}
+
+// filterEventHandler forwards events selected by filter.
+type filterEventHandler struct {
+	inner  EventHandler
+	filter func(DispatcherEvent) bool
+}
+
+// NewFilterEventHandler creates an EventHandler which only forwards events
+// to inner when filter returns true.
+func NewFilterEventHandler(inner EventHandler, filter func(DispatcherEvent) bool) EventHandler {
+	return &filterEventHandler{inner: inner, filter: filter}
+}
+
+// HandleEvent implements EventHandler.
+func (h *filterEventHandler) HandleEvent(ctx context.Context, event DispatcherEvent) {
+	if h.filter(event) {
+		h.inner.HandleEvent(ctx, event)
+	}
+}
+
 // DispatcherEvent is the abstract of dispatcher events.
 type DispatcherEvent interface {
 	Dispatcher() *Dispatcher
@@ -41,7 +82,18 @@ type DispatcherStartEvent struct {
 // DispatcherEndEvent is the event when Dispatcher.Run ends.
 type DispatcherEndEvent struct {
 	dispatcherEventBase
-	Err error
+	Err        error
+	CacheStats CacheStats
+}
+
+// DispatcherProgressEvent is the event emitted periodically during Dispatcher.Run.
+type DispatcherProgressEvent struct {
+	dispatcherEventBase
+	Completed int
+	Total     int
+	Running   int
+	// ETA is the estimated remaining duration, zero if unknown.
+	ETA time.Duration
 }
 
 // TaskStartEvent is the event indicates a task is enqueued.
@@ -65,6 +117,19 @@ type TaskResult struct {
 	EndTime               int64
 	Skipped               bool
 	Err                   *string
+	// PeakRSS is the maximum resident set size in bytes among processes
+	// executed by the task.
+	PeakRSS int64
+	// UserCPUNs is the total user CPU time in nanoseconds of processes
+	// executed by the task.
+	UserCPUNs int64
+	// BuildSequence is increased monotonically across all tasks in the repo
+	// every time a task is executed, indicating the order of the last builds.
+	BuildSequence int64
+	// Warnings are reported by the tool during the last execution.
+	Warnings []string
+	// Metrics are reported by the tool during the last execution.
+	Metrics map[string]string
 }
 
 // Dispatcher dispatches tasks.
@@ -76,11 +141,43 @@ type Dispatcher struct {
 	LogDir       string
 	NumWorkers   int
 	EventHandler EventHandler
+	// ProgressInterval specifies the interval of DispatcherProgressEvent.
+	// If zero, defaultProgressInterval is used. If negative, no progress
+	// events are emitted.
+	ProgressInterval time.Duration
+	// GracefulShutdown when set to true, running tasks are not interrupted when
+	// the context is canceled. No more tasks are started, and Run returns after
+	// all running tasks complete.
+	GracefulShutdown bool
+	// MaxFailures aborts the build after the specified number of failed tasks.
+	// No more tasks are started and running tasks are allowed to complete.
+	// If zero, the build continues until no more tasks can run.
+	MaxFailures int
+	// TaskOutput optionally provides a writer receiving stdout/stderr of a task
+	// while it's running, in addition to the output file in LogDir.
+	// It's called from worker goroutines. If it returns nil, the output is
+	// only written to the output file.
+	TaskOutput func(task *Task) io.Writer
+	// CacheStats is populated during Run.
+	CacheStats CacheStats
+	// ResultStore optionally persists task results. If nil, results are
+	// stored as files in CacheDir.
+	ResultStore TaskResultStore
 
 	toolsLock       sync.RWMutex
 	registeredTools map[string]*ExtTool
 }
 
+// CacheStats is the statistics of cache usage in a build.
+type CacheStats struct {
+	// Hits is the number of skipped tasks.
+	Hits int `json:"hits"`
+	// Misses is the number of tasks executed successfully.
+	Misses int `json:"misses"`
+	// Errors is the number of failed cache operations.
+	Errors int `json:"errors"`
+}
+
 type execution struct {
 	dispatcher   *Dispatcher
 	graph        *TaskGraph
@@ -90,7 +187,11 @@ type execution struct {
 	requestCh    chan *Task
 	resultCh     chan *Task
 	eventCh      chan DispatcherEvent
-	logger       *log.Logger
+	// progressCh is separated from eventCh, so a pending progress request
+	// never blocks workers from sending events.
+	progressCh chan struct{}
+	logger     *log.Logger
+	startTime  time.Time
 }
 
 type dispatcherEventBaseAccessor interface {
@@ -122,6 +223,7 @@ func NewDispatcher(g *TaskGraph) *Dispatcher {
 		OutBaseDir:      g.Repo.OutDir(),
 		CacheDir:        filepath.Join(g.Repo.dataDir, cacheFolderName),
 		LogDir:          g.Repo.LogDir(),
+		NumWorkers:      g.Repo.root.MaxWorkers,
 		registeredTools: make(map[string]*ExtTool),
 	}
 }
@@ -145,10 +247,12 @@ func (d *Dispatcher) Run(ctx context.Context) error {
 	if x.numWorkers == 0 {
 		x.numWorkers = runtime.NumCPU()
 	}
+	d.CacheStats = CacheStats{}
 
 	x.requestCh = make(chan *Task, x.numWorkers)
 	x.resultCh = make(chan *Task, x.numWorkers)
 	x.eventCh = make(chan DispatcherEvent, x.numWorkers)
+	x.progressCh = make(chan struct{}, 1)
 
 	return x.run(ctx)
 }
@@ -158,7 +262,12 @@ func (x *execution) haveWorkToDo() bool {
 }
 
 func (x *execution) run(ctx context.Context) error {
-	workerCtx, cancel := context.WithCancel(ctx)
+	workerBaseCtx := ctx
+	if x.dispatcher.GracefulShutdown {
+		// Running tasks should not be interrupted by cancellation of ctx.
+		workerBaseCtx = context.Background()
+	}
+	workerCtx, cancel := context.WithCancel(workerBaseCtx)
 	var wg sync.WaitGroup
 	for i := 0; i < x.numWorkers; i++ {
 		wg.Add(1)
@@ -168,6 +277,15 @@ func (x *execution) run(ctx context.Context) error {
 		}(i)
 	}
 
+	x.startTime = time.Now()
+	if interval := x.progressInterval(); interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x.runProgressTicker(workerCtx, interval)
+		}()
+	}
+
 	x.notifyEvent(ctx, &DispatcherStartEvent{NumWorkers: x.numWorkers})
 
 	x.logger.Printf("%d workers started", x.numWorkers)
@@ -185,6 +303,18 @@ func (x *execution) run(ctx context.Context) error {
 		if err = x.waitResults(ctx); err != nil {
 			break
 		}
+
+		if max := x.dispatcher.MaxFailures; max > 0 && x.failureCount >= max {
+			err = fmt.Errorf("%w: aborted after %d failures", ErrSomeTaskFailed, x.failureCount)
+			break
+		}
+	}
+
+	if err != nil && (x.dispatcher.GracefulShutdown || errors.Is(err, ErrSomeTaskFailed)) {
+		x.logger.Printf("Waiting for %d running tasks: %v", x.runningCount, err)
+		for x.runningCount > 0 {
+			x.waitResults(context.Background())
+		}
 	}
 
 	x.logger.Println("Stopping workers")
@@ -221,7 +351,7 @@ func (x *execution) run(ctx context.Context) error {
 		}
 	}
 
-	x.notifyEvent(ctx, &DispatcherEndEvent{Err: err})
+	x.notifyEvent(ctx, &DispatcherEndEvent{Err: err, CacheStats: x.dispatcher.CacheStats})
 
 	return err
 }
@@ -236,6 +366,7 @@ func (x *execution) enqueue(ctx context.Context) error {
 		elm := x.graph.ReadyList.Front()
 		task := elm.Value.(*Task)
 		task.State = TaskQueued
+		task.completedBefore = x.graph.CompleteList.Len()
 		select {
 		case <-ctx.Done():
 			task.State = TaskReady
@@ -255,6 +386,10 @@ func (x *execution) waitResults(ctx context.Context) error {
 		return ctx.Err()
 	case event := <-x.eventCh:
 		x.notifyEvent(ctx, event)
+	case <-x.progressCh:
+		progress := &DispatcherProgressEvent{}
+		x.fillProgress(progress)
+		x.notifyEvent(ctx, progress)
 	case task := <-x.resultCh:
 		x.complete(ctx, task)
 	}
@@ -267,6 +402,14 @@ func (x *execution) complete(ctx context.Context, task *Task) {
 	if task.Err != nil && !errors.Is(task.Err, ErrSkipped) {
 		x.failureCount++
 	}
+	stats := &x.dispatcher.CacheStats
+	switch {
+	case task.Skipped():
+		stats.Hits++
+	case task.Err == nil:
+		stats.Misses++
+	}
+	stats.Errors += task.cacheErrors
 	x.logger.Printf("Completed task %s, err: %v", task.Name(), task.Err)
 	x.notifyEvent(ctx, &TaskCompleteEvent{Task: task})
 }
@@ -279,6 +422,42 @@ func (x *execution) notifyEvent(ctx context.Context, event DispatcherEvent) {
 	}
 }
 
+func (x *execution) progressInterval() time.Duration {
+	if interval := x.dispatcher.ProgressInterval; interval != 0 {
+		return interval
+	}
+	return defaultProgressInterval
+}
+
+// runProgressTicker periodically requests DispatcherProgressEvent.
+// The event is populated in the dispatching loop which owns the graph states.
+func (x *execution) runProgressTicker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Drop the tick if the previous one is not handled yet.
+			select {
+			case x.progressCh <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (x *execution) fillProgress(event *DispatcherProgressEvent) {
+	event.Completed = x.graph.CompleteList.Len()
+	event.Total = len(x.graph.Tasks)
+	event.Running = x.runningCount
+	if event.Completed > 0 && event.Completed < event.Total {
+		elapsed := time.Since(x.startTime)
+		event.ETA = elapsed * time.Duration(event.Total-event.Completed) / time.Duration(event.Completed)
+	}
+}
+
 func (x *execution) runWorker(ctx context.Context, index int) {
 	for {
 		select {
@@ -290,10 +469,14 @@ func (x *execution) runWorker(ctx context.Context, index int) {
 			}
 			x.logger.Printf("Worker %d start task %s", index, t.Name())
 			t.StartTime, t.State = time.Now(), TaskRunning
-			t.Outputs = nil
+			t.Outputs, t.Warnings = nil, nil
 			x.eventCh <- &TaskStartEvent{Task: t, Worker: index}
 			var result *TaskResult
 			result, t.Err = x.executeTask(ctx, t, index)
+			if ctxErr := ctx.Err(); t.Err != nil && t.Err != ErrSkipped && ctxErr != nil && !errors.Is(t.Err, ctxErr) {
+				// The tool may not report cancellation, e.g. the process is killed.
+				t.Err = &interruptedError{err: t.Err, ctxErr: ctxErr}
+			}
 			t.EndTime, t.State = time.Now(), TaskCompleted
 			x.writeTaskResult(t, result)
 			x.logger.Printf("Worker %d complete task %s", index, t.Name())
@@ -309,8 +492,15 @@ func (x *execution) executeTask(ctx context.Context, task *Task, worker int) (*T
 		CacheDir:  x.dispatcher.CacheDir,
 		OutDir:    filepath.Join(x.dispatcher.OutBaseDir, task.Target.Project.Dir),
 		Skippable: !task.Target.Meta().Always && !task.NoSkip,
+
+		templateInputs: make(map[string]*fileEntry),
+		usage:          &taskUsage{},
+		cacheErrors:    new(int),
+		metrics:        make(map[string]string),
 	}
 	result := x.loadTaskResult(task)
+	result.PeakRSS, result.UserCPUNs = 0, 0
+	result.Metrics = nil
 	if result.SuccessBuildStartTime == 0 || result.SuccessBuildEndTime == 0 {
 		x.logger.Println("NotSkippable: no previous successful build.")
 		xctx.Skippable = false
@@ -351,10 +541,21 @@ func (x *execution) executeTask(ctx context.Context, task *Task, worker int) (*T
 		return result, nil
 	}
 	xctx.Task.Executor = tool
-	os.Remove(x.taskResultFile(task))
+	if store, ok := x.resultStore().(*FileResultStore); ok {
+		store.remove(task.Name())
+	}
 
-	xctx.ExtraEnv = []string{
+	defaultEnvTemplates, err := xctx.Repo().defaultEnvTemplates()
+	if err != nil {
+		return result, err
+	}
+	defaultEnv, err := xctx.RenderEnvs(defaultEnvTemplates)
+	if err != nil {
+		return result, fmt.Errorf("default-env: %w", err)
+	}
+	xctx.ExtraEnv = append(defaultEnv,
 		fmt.Sprintf("REPOS_PROJECT=%s", xctx.Project().Name),
+		fmt.Sprintf("REPOS_PROJECT_VERSION=%s", xctx.Project().Meta().Version),
 		fmt.Sprintf("REPOS_TARGET=%s", xctx.Target().Name.GlobalName()),
 		fmt.Sprintf("REPOS_TARGET_NAME=%s", xctx.Target().Name.LocalName),
 		fmt.Sprintf("REPOS_ROOT_DIR=%s", xctx.Repo().RootDir),
@@ -365,7 +566,11 @@ func (x *execution) executeTask(ctx context.Context, task *Task, worker int) (*T
 		fmt.Sprintf("REPOS_PROJECT_META_DIR=%s", xctx.MetaDir()),
 		fmt.Sprintf("REPOS_OUTPUT_BASE=%s", xctx.Repo().OutDir()),
 		fmt.Sprintf("REPOS_OUTPUT_DIR=%s", xctx.OutDir),
-	}
+		fmt.Sprintf("REPOS_TASK_NUM=%d", task.completedBefore),
+		fmt.Sprintf("REPOS_TASK_TOTAL=%d", len(task.Graph.Tasks)),
+		fmt.Sprintf("REPOS_WORKER_COUNT=%d", x.numWorkers),
+		fmt.Sprintf("REPOS_WORKER_INDEX=%d", worker),
+	)
 	if xctx.Skippable {
 		xctx.ExtraEnv = append(xctx.ExtraEnv, "REPOS_TASK_SKIPPABLE=1")
 	}
@@ -393,9 +598,20 @@ func (x *execution) executeTask(ctx context.Context, task *Task, worker int) (*T
 	}
 	defer outFile.Close()
 	xctx.LogWriter = logFile
-	xctx.Stdout, xctx.Stderr = outFile, outFile
+	var output io.Writer = outFile
+	if x.dispatcher.TaskOutput != nil {
+		if w := x.dispatcher.TaskOutput(task); w != nil {
+			output = io.MultiWriter(outFile, w)
+		}
+	}
+	xctx.Stdout, xctx.Stderr = output, output
 	xctx.Logger = log.New(xctx.LogWriter, task.Target.ToolName()+" ", log.LstdFlags)
 	err = tool.Execute(ctx, &xctx)
+	result.PeakRSS, result.UserCPUNs = xctx.usage.PeakRSS, xctx.usage.UserCPUNs
+	task.cacheErrors = *xctx.cacheErrors
+	if len(xctx.metrics) > 0 {
+		result.Metrics = xctx.metrics
+	}
 	if err != nil && err != ErrSkipped {
 		return result, err
 	}
@@ -405,13 +621,15 @@ func (x *execution) executeTask(ctx context.Context, task *Task, worker int) (*T
 	return result, err
 }
 
-func (x *execution) taskResultFile(task *Task) string {
-	return filepath.Join(x.dispatcher.CacheDir, task.Name()+".result")
+func (x *execution) resultStore() TaskResultStore {
+	if store := x.dispatcher.ResultStore; store != nil {
+		return store
+	}
+	return &FileResultStore{Dir: x.dispatcher.CacheDir}
 }
 
 func (x *execution) loadTaskResult(task *Task) *TaskResult {
-	fn := x.taskResultFile(task)
-	result, err := loadTaskResultFrom(fn)
+	result, err := x.resultStore().Load(task.Name())
 	if err != nil {
 		x.logger.Printf("TaskResult %q: %v", task.Name(), err)
 		return &TaskResult{}
@@ -422,6 +640,7 @@ func (x *execution) loadTaskResult(task *Task) *TaskResult {
 func (x *execution) writeTaskResult(task *Task, result *TaskResult) {
 	result.StartTime = task.StartTime.UnixNano()
 	result.EndTime = task.EndTime.UnixNano()
+	result.Warnings = task.Warnings
 	result.Skipped = false
 	if task.Err == ErrSkipped {
 		result.Skipped = true
@@ -432,14 +651,13 @@ func (x *execution) writeTaskResult(task *Task, result *TaskResult) {
 		result.SuccessBuildStartTime = result.StartTime
 		result.SuccessBuildEndTime = result.EndTime
 	}
-	data, err := json.Marshal(result)
-	if err != nil {
-		x.logger.Printf("EncodeResult of %q error: %v", task.Name(), err)
-		return
+	if seq, err := nextBuildSequence(x.dispatcher.DataDir); err != nil {
+		x.logger.Printf("BuildSequence of %q error: %v", task.Name(), err)
+	} else {
+		result.BuildSequence = seq
 	}
-	fn := x.taskResultFile(task)
-	if err := os.WriteFile(fn, data, 0644); err != nil {
-		x.logger.Printf("WriteResult %q error: %v", fn, err)
+	if err := x.resultStore().Save(task.Name(), result); err != nil {
+		x.logger.Printf("WriteResult of %q error: %v", task.Name(), err)
 	}
 }
 
@@ -500,11 +718,11 @@ func (x *execution) registerToolIfRequested(xctx *ToolExecContext) error {
 func loadTaskResultFrom(fn string) (*TaskResult, error) {
 	data, err := os.ReadFile(fn)
 	if err != nil {
-		return nil, fmt.Errorf("load error: %w", err)
+		return nil, fmt.Errorf("load %q error: %w", fn, err)
 	}
 	var result TaskResult
 	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, fmt.Errorf("parse error: %w", err)
+		return nil, fmt.Errorf("%w %q: %v", ErrCorrupt, fn, err)
 	}
 	return &result, nil
 }
@@ -8,8 +8,18 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// ArtifactURLOutputKey is the special key of the "O" command
+// reporting the URL of the remote artifact instead of an output file.
+const ArtifactURLOutputKey = "ARTIFACT_URL"
+
+// extToolProtocolVersion is the version of the protocol between the
+// controller and external tools, sent in reply to the "D" command.
+const extToolProtocolVersion = 1
+
 // ExtTool registers tool using external programs from output of a target.
 type ExtTool struct {
 	Task        *Task
@@ -25,6 +35,14 @@ type ExtToolExecutor struct {
 	envTemplates []*ToolParamTemplate
 }
 
+// extToolDeadline cancels the external tool if no heartbeat ("T" command)
+// is received within timeout.
+type extToolDeadline struct {
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
 // CreateToolExecutor implements Tool.
 func (t *ExtTool) CreateToolExecutor(target *Target) (ToolExecutor, error) {
 	var params map[string]interface{}
@@ -71,6 +89,34 @@ func (x *ExtToolExecutor) Execute(ctx context.Context, xctx *ToolExecContext) er
 
 // ExecuteExtToolCmd executes the external program as a tool.
 func ExecuteExtToolCmd(ctx context.Context, xctx *ToolExecContext, cmd *exec.Cmd, envs ...string) error {
+	return executeExtToolCmd(ctx, xctx, cmd, nil, envs...)
+}
+
+// ExecuteExtToolCmdWithTimeout executes the external program as a tool with timeout.
+// The command is created by createCmd using a context which is canceled if the
+// tool doesn't finish or send a heartbeat ("T" command) within timeout.
+// If timeout is zero, it's the same as ExecuteExtToolCmd.
+func ExecuteExtToolCmdWithTimeout(ctx context.Context, xctx *ToolExecContext, timeout time.Duration, createCmd func(context.Context) *exec.Cmd, envs ...string) error {
+	if timeout == 0 {
+		return ExecuteExtToolCmd(ctx, xctx, createCmd(ctx), envs...)
+	}
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	deadline := &extToolDeadline{timeout: timeout}
+	deadline.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&deadline.expired, 1)
+		cancel()
+	})
+	defer deadline.timer.Stop()
+	err := executeExtToolCmd(cmdCtx, xctx, createCmd(cmdCtx), deadline, envs...)
+	if deadline.isExpired() {
+		xctx.Logger.Printf("CMD TIMEOUT no heartbeat in %s", timeout)
+		return fmt.Errorf("external tool timed out after %s without heartbeat: %w", timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+func executeExtToolCmd(ctx context.Context, xctx *ToolExecContext, cmd *exec.Cmd, deadline *extToolDeadline, envs ...string) error {
 	xctx.AddBinToPathFromDeps(cmd)
 	xctx.ExtendEnv(cmd, envs...)
 	cmd.Stdin = nil
@@ -95,8 +141,9 @@ func ExecuteExtToolCmd(ctx context.Context, xctx *ToolExecContext, cmd *exec.Cmd
 	cr := &CacheReporter{Cache: NewFilesCache(xctx)}
 	cr.AddOpaque(cmd.Args...)
 	cr.AddOpaque(envs...)
-	err = controlCmd(xctx, cr, in, out)
+	err = controlCmd(xctx, cr, deadline, in, out)
 	execErr := cmd.Wait()
+	xctx.recordUsage(cmd)
 	if err != nil {
 		if err == ErrSkipped {
 			xctx.Output(cr.SavedTaskOutputs())
@@ -111,7 +158,40 @@ func ExecuteExtToolCmd(ctx context.Context, xctx *ToolExecContext, cmd *exec.Cmd
 	return nil
 }
 
-func controlCmd(xctx *ToolExecContext, cache *CacheReporter, in io.WriteCloser, out io.Reader) error {
+func (d *extToolDeadline) reset() {
+	if d != nil {
+		d.timer.Reset(d.timeout)
+	}
+}
+
+func (d *extToolDeadline) isExpired() bool {
+	return atomic.LoadInt32(&d.expired) != 0
+}
+
+// controlCmd talks to the external tool using a line based protocol.
+// The tool writes commands to its stdout, one per line, with the command
+// letter followed by the value:
+//
+//   - D<letters>: the optional handshake declaring the supported command
+//     letters, e.g. "DSIOVT", the controller replies "D<version>", e.g. "D1".
+//     It should be the first command, tools not sending it never receive the
+//     reply, so the replies to "V" are not confused with it;
+//   - S<path>: a source file, or a directory recursively if ending with "/";
+//   - I<path>: an input file, or a directory recursively if ending with "/";
+//   - O[KEY:]<path>: an output, the key ARTIFACT_URL reports a remote artifact;
+//   - G<path>: a generated file;
+//   - P<value>: an opaque value contributing to the cache;
+//   - V: verify the cache, the controller replies "1" if the task can be
+//     skipped, or "0" otherwise;
+//   - C: clear the saved cache;
+//   - T: heartbeat, resets the timeout;
+//   - L<message>: write the message to the task log;
+//   - W<message>: report a warning;
+//   - M<KEY>=<VALUE>: report a metric;
+//   - X: skip the task.
+//
+// Lines with unknown command letters are ignored.
+func controlCmd(xctx *ToolExecContext, cache *CacheReporter, deadline *extToolDeadline, in io.WriteCloser, out io.Reader) error {
 	defer in.Close()
 	scanner := bufio.NewScanner(out)
 	for scanner.Scan() {
@@ -149,6 +229,10 @@ func controlCmd(xctx *ToolExecContext, cache *CacheReporter, in io.WriteCloser,
 			} else {
 				relPath = items[0]
 			}
+			if key == ArtifactURLOutputKey {
+				cache.SetArtifactURL(relPath)
+				continue
+			}
 			cache.AddOutput(key, relPath)
 		case 'G':
 			cache.AddGenerated(val)
@@ -162,9 +246,34 @@ func controlCmd(xctx *ToolExecContext, cache *CacheReporter, in io.WriteCloser,
 			}
 		case 'C':
 			cache.ClearSaved()
+		case 'T':
+			deadline.reset()
+		case 'L':
+			xctx.Logger.Print(val)
+		case 'W':
+			xctx.Warn(val)
+		case 'M':
+			items := strings.SplitN(val, "=", 2)
+			if len(items) != 2 || items[0] == "" {
+				return fmt.Errorf("invalid metric %q, expect KEY=VALUE", val)
+			}
+			xctx.ReportMetric(items[0], items[1])
 		case 'X':
 			return ErrSkipped
+		case 'D':
+			checkCapabilities(xctx, val, deadline)
+			fmt.Fprintf(in, "D%d\n", extToolProtocolVersion)
 		}
 	}
 	return nil
 }
+
+// checkCapabilities warns if the command letters declared by the tool in the
+// "D" handshake lack the features used by the controller.
+// Without heartbeat, the timeout still applies, so the tool is killed if it
+// doesn't finish within the timeout.
+func checkCapabilities(xctx *ToolExecContext, commands string, deadline *extToolDeadline) {
+	if deadline != nil && !strings.ContainsRune(commands, 'T') {
+		xctx.Warn(fmt.Sprintf("external tool doesn't declare heartbeat (T command), it's killed if not finished within %s", deadline.timeout))
+	}
+}
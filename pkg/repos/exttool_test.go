@@ -0,0 +1,53 @@
+package repos
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"testing"
+)
+
+// runFakeExtTool runs controlCmd against a fake tool which writes commands
+// and reads a reply from stdin after each command in needReply.
+func runFakeExtTool(t *testing.T, commands []string, needReply map[string]bool) []string {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	repliesCh := make(chan []string, 1)
+	go func() {
+		defer outW.Close()
+		var replies []string
+		reader := bufio.NewReader(inR)
+		for _, cmd := range commands {
+			if _, err := io.WriteString(outW, cmd+"\n"); err != nil {
+				break
+			}
+			if needReply[cmd] {
+				reply, err := reader.ReadString('\n')
+				if err != nil {
+					break
+				}
+				replies = append(replies, reply[:len(reply)-1])
+			}
+		}
+		repliesCh <- replies
+	}()
+	xctx := &ToolExecContext{Task: &Task{}, Logger: log.New(io.Discard, "", 0)}
+	if err := controlCmd(xctx, &CacheReporter{}, nil, inW, outR); err != nil {
+		t.Fatalf("controlCmd error: %v", err)
+	}
+	return <-repliesCh
+}
+
+func TestExtToolVerifyWithoutHandshake(t *testing.T) {
+	replies := runFakeExtTool(t, []string{"V"}, map[string]bool{"V": true})
+	if len(replies) != 1 || replies[0] != "0" {
+		t.Errorf("expect reply 0 to V, got %q", replies)
+	}
+}
+
+func TestExtToolVerifyAfterHandshake(t *testing.T) {
+	replies := runFakeExtTool(t, []string{"DV", "V"}, map[string]bool{"DV": true, "V": true})
+	if len(replies) != 2 || replies[0] != "D1" || replies[1] != "0" {
+		t.Errorf("expect replies D1 and 0, got %q", replies)
+	}
+}
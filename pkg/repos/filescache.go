@@ -11,6 +11,13 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/karrick/godirwalk"
+)
+
+const (
+	// stateFileVersion is the current version of state file format.
+	stateFileVersion = 1
 )
 
 var (
@@ -19,6 +26,10 @@ var (
 
 // FilesCache tracks files for detecting changes.
 type FilesCache struct {
+	// FollowSymlinks traverses into symbolic links to directories
+	// when adding inputs recursively.
+	FollowSymlinks bool
+
 	xctx      *ToolExecContext
 	stateFile string
 	current   fileCacheContent
@@ -28,9 +39,14 @@ type FilesCache struct {
 type fileEntry struct {
 	Dir   bool
 	MTime time.Time
+	// Symlink indicates the entry is a symbolic link.
+	// Dir and MTime are from the link target.
+	Symlink    bool
+	LinkTarget string
 }
 
 type fileCacheContent struct {
+	Version     int
 	Inputs      map[string]*fileEntry
 	Outputs     map[string]*fileEntry
 	Generates   map[string]*fileEntry
@@ -49,6 +65,7 @@ func NewFilesCache(xctx *ToolExecContext) *FilesCache {
 			Generates: make(map[string]*fileEntry),
 			TaskOutputs: OutputFiles{
 				Extra: make(map[string]string),
+				Dirs:  make(map[string]string),
 			},
 		},
 	}
@@ -57,20 +74,44 @@ func NewFilesCache(xctx *ToolExecContext) *FilesCache {
 // AddInput implements Cache.
 func (s *FilesCache) AddInput(relPath string, recursive bool) error {
 	if recursive {
-		return filepath.Walk(filepath.Join(s.xctx.SourceDir(), relPath), func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			s.addInputEntry(path, &fileEntry{Dir: info.IsDir(), MTime: info.ModTime()})
-			return nil
+		return godirwalk.Walk(filepath.Join(s.xctx.SourceDir(), relPath), &godirwalk.Options{
+			Callback: func(path string, de *godirwalk.Dirent) error {
+				if de.IsSymlink() {
+					entry, err := newInputFileEntry(path)
+					if err == nil {
+						s.addInputEntry(path, entry)
+						return nil
+					}
+					if !os.IsNotExist(err) {
+						return err
+					}
+					// A broken symbolic link is added as the link itself.
+				}
+				info, err := os.Lstat(path)
+				if err != nil {
+					return err
+				}
+				s.addInputEntry(path, &fileEntry{Dir: info.IsDir(), MTime: info.ModTime()})
+				return nil
+			},
+			ErrorCallback: func(path string, err error) godirwalk.ErrorAction {
+				// Broken symbolic links can't be followed.
+				if os.IsNotExist(err) {
+					return godirwalk.SkipNode
+				}
+				return godirwalk.Halt
+			},
+			FollowSymbolicLinks: s.FollowSymlinks,
+			AllowNonDirectory:   true,
+			Unsorted:            true,
 		})
 	}
 	fn := filepath.Join(s.xctx.SourceDir(), relPath)
-	fi, err := os.Stat(fn)
+	entry, err := newInputFileEntry(fn)
 	if err != nil {
 		return err
 	}
-	s.addInputEntry(fn, &fileEntry{Dir: fi.IsDir(), MTime: fi.ModTime()})
+	s.addInputEntry(fn, entry)
 	return nil
 }
 
@@ -82,27 +123,72 @@ func (s *FilesCache) AddSource(relPath string, recursive bool) error {
 	return s.AddInput(relPath, recursive)
 }
 
+// AddInputGlob implements Cache.
+func (s *FilesCache) AddInputGlob(pattern string, recursive bool) error {
+	baseDir := s.xctx.SourceDir()
+	matches, err := filepath.Glob(filepath.Join(baseDir, pattern))
+	if err != nil {
+		return fmt.Errorf("glob %q error: %w", pattern, err)
+	}
+	for _, fn := range matches {
+		relPath, err := filepath.Rel(baseDir, fn)
+		if err != nil {
+			return err
+		}
+		if err := s.AddInput(relPath, recursive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSourceGlob implements Cache.
+func (s *FilesCache) AddSourceGlob(pattern string, recursive bool) error {
+	if srcDir := s.xctx.SourceSubDir(); srcDir != "" {
+		return s.AddInputGlob(filepath.Join(srcDir, pattern), recursive)
+	}
+	return s.AddInputGlob(pattern, recursive)
+}
+
 func (s *FilesCache) addInputEntry(fn string, entry *fileEntry) {
 	key := filepath.Clean(fn)
 	s.current.Inputs[key] = entry
 	s.xctx.Logger.Printf("Input %q %s", key, entry.String())
 }
 
+// addTemplateInputs adds files matched by templates as inputs.
+func (s *FilesCache) addTemplateInputs() {
+	for fn, entry := range s.xctx.templateInputs {
+		if _, ok := s.current.Inputs[fn]; !ok {
+			s.addInputEntry(fn, entry)
+		}
+	}
+}
+
 // AddOutput implements Cache.
 func (s *FilesCache) AddOutput(key, relPath string) {
 	dir := strings.HasSuffix(relPath, string(filepath.Separator))
 	cleanPath := strings.TrimRight(relPath, string(filepath.Separator))
 	fn := filepath.Join(s.xctx.OutDir, cleanPath)
 	s.current.Outputs[fn] = &fileEntry{Dir: dir}
-	if key == "" {
+	switch {
+	case key == "":
 		s.current.TaskOutputs.Primary = relPath
 		s.xctx.Logger.Printf("Output PRIMARY %q", relPath)
-	} else {
+	case dir:
+		s.current.TaskOutputs.Dirs[key] = cleanPath
+		s.xctx.Logger.Printf("Output DIR [%s] %q", key, cleanPath)
+	default:
 		s.current.TaskOutputs.Extra[key] = relPath
 		s.xctx.Logger.Printf("Output [%s] %q", key, relPath)
 	}
 }
 
+// AddOutputDir implements Cache.
+func (s *FilesCache) AddOutputDir(key, relPath string) {
+	s.AddOutput(key, strings.TrimRight(relPath, string(filepath.Separator))+string(filepath.Separator))
+}
+
 // AddGenerated implements Cache.
 func (s *FilesCache) AddGenerated(relPath string) {
 	dir := strings.HasSuffix(relPath, string(filepath.Separator))
@@ -113,6 +199,12 @@ func (s *FilesCache) AddGenerated(relPath string) {
 	s.xctx.Logger.Printf("Generate %q", relPath)
 }
 
+// SetArtifactURL implements Cache.
+func (s *FilesCache) SetArtifactURL(url string) {
+	s.current.TaskOutputs.ArtifactURL = url
+	s.xctx.Logger.Printf("Artifact %q", url)
+}
+
 // AddOpaque implements Cache.
 func (s *FilesCache) AddOpaque(opaque ...string) {
 	for _, val := range opaque {
@@ -133,17 +225,19 @@ func (s *FilesCache) Load() error {
 
 // Persist implements Cache.
 func (s *FilesCache) Persist() error {
+	s.addTemplateInputs()
 	if err := refreshFileEntries(s.current.Outputs); err != nil {
 		return fmt.Errorf("output: %w", err)
 	}
 	if err := refreshFileEntries(s.current.Generates); err != nil {
 		return fmt.Errorf("generate: %w", err)
 	}
+	s.current.Version = stateFileVersion
 	data, err := json.Marshal(&s.current)
 	if err != nil {
 		return fmt.Errorf("encoding state error: %w", err)
 	}
-	if err := os.WriteFile(s.stateFile, data, 0644); err != nil {
+	if err := writeFileAtomic(s.stateFile, data, 0644); err != nil {
 		return fmt.Errorf("write state %q error: %w", s.stateFile, err)
 	}
 	return nil
@@ -158,10 +252,17 @@ func (s *FilesCache) ClearSaved() error {
 func (s *FilesCache) Verify() bool {
 	if s.saved == nil {
 		if err := s.Load(); err != nil {
-			s.xctx.Logger.Printf("Cache %v", err)
+			if errors.Is(err, ErrCorrupt) {
+				// Unlike a missing state, a corrupt state indicates a cache problem.
+				s.xctx.Logger.Printf("Cache invalid: %v", err)
+				s.xctx.countCacheError()
+			} else {
+				s.xctx.Logger.Printf("Cache %v", err)
+			}
 			return false
 		}
 	}
+	s.addTemplateInputs()
 	if !compareFileEntryKeys(s.saved.Outputs, s.current.Outputs, s.xctx.Logger, "outputs") ||
 		!compareFileEntryKeys(s.saved.Generates, s.current.Generates, s.xctx.Logger, "generates") ||
 		!compareFileEntryMaps(s.saved.Inputs, s.current.Inputs, s.xctx.Logger, "inputs") {
@@ -170,7 +271,8 @@ func (s *FilesCache) Verify() bool {
 	if saved, curr := s.saved.TaskOutputs.Primary, s.current.TaskOutputs.Primary; saved != curr {
 		s.xctx.Logger.Printf("Cache primary output %q vs %q", saved, curr)
 	}
-	if !compareExtraTaskOutputs(s.saved.TaskOutputs.Extra, s.current.TaskOutputs.Extra, s.xctx.Logger) {
+	if !compareExtraTaskOutputs(s.saved.TaskOutputs.Extra, s.current.TaskOutputs.Extra, s.xctx.Logger, "extra outputs") ||
+		!compareExtraTaskOutputs(s.saved.TaskOutputs.Dirs, s.current.TaskOutputs.Dirs, s.xctx.Logger, "output dirs") {
 		return false
 	}
 	if len(s.saved.Opaque) != len(s.current.Opaque) {
@@ -207,11 +309,35 @@ func (s *FilesCache) SavedTaskOutputs() OutputFiles {
 	return OutputFiles{}
 }
 
+// newInputFileEntry creates fileEntry for an input file.
+// The symlink is followed, and the link target is recorded.
+func newInputFileEntry(fn string) (*fileEntry, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return nil, err
+	}
+	entry := &fileEntry{Dir: fi.IsDir(), MTime: fi.ModTime()}
+	lfi, err := os.Lstat(fn)
+	if err != nil {
+		return nil, err
+	}
+	if lfi.Mode()&os.ModeSymlink != 0 {
+		if entry.LinkTarget, err = os.Readlink(fn); err != nil {
+			return nil, err
+		}
+		entry.Symlink = true
+	}
+	return entry, nil
+}
+
 func (f *fileEntry) String() string {
 	fileType := "F"
 	if f.Dir {
 		fileType = "D"
 	}
+	if f.Symlink {
+		return fmt.Sprintf(`L%s%v:%s`, fileType, f.MTime.UnixNano(), f.LinkTarget)
+	}
 	return fmt.Sprintf(`%s%v`, fileType, f.MTime.UnixNano())
 }
 
@@ -226,6 +352,15 @@ func (f *fileEntry) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &str); err != nil {
 		return err
 	}
+	var symlink bool
+	var linkTarget string
+	if strings.HasPrefix(str, "L") {
+		pos := strings.Index(str, ":")
+		if pos < 0 {
+			return errInvalidFileEntryValue
+		}
+		symlink, linkTarget, str = true, str[pos+1:], str[1:pos]
+	}
 	if str == "" {
 		return errInvalidFileEntryValue
 	}
@@ -238,6 +373,7 @@ func (f *fileEntry) UnmarshalJSON(data []byte) error {
 		return errInvalidFileEntryValue
 	}
 	f.Dir, f.MTime = fileType == 'D', time.Unix(0, timeVal)
+	f.Symlink, f.LinkTarget = symlink, linkTarget
 	return nil
 }
 
@@ -260,6 +396,14 @@ func compareFileEntryMaps(m1, m2 map[string]*fileEntry, logger *log.Logger, titl
 			logger.Printf("Cache %s[%q] mtime %s vs %s", title, fn, mtime1, mtime2)
 			return false
 		}
+		if link1, link2 := entry1.Symlink, entry2.Symlink; link1 != link2 {
+			logger.Printf("Cache %s[%q] IsSymlink %v vs %v", title, fn, link1, link2)
+			return false
+		}
+		if target1, target2 := entry1.LinkTarget, entry2.LinkTarget; target1 != target2 {
+			logger.Printf("Cache %s[%q] link target %q vs %q", title, fn, target1, target2)
+			return false
+		}
 	}
 	return true
 }
@@ -278,14 +422,14 @@ func compareFileEntryKeys(m1, m2 map[string]*fileEntry, logger *log.Logger, titl
 	return true
 }
 
-func compareExtraTaskOutputs(m1, m2 map[string]string, logger *log.Logger) bool {
+func compareExtraTaskOutputs(m1, m2 map[string]string, logger *log.Logger, title string) bool {
 	if l1, l2 := len(m1), len(m2); l1 != l2 {
-		logger.Printf("Cache extra outputs length %d vs %d", l1, l2)
+		logger.Printf("Cache %s length %d vs %d", title, l1, l2)
 		return false
 	}
 	for key := range m1 {
 		if _, ok := m2[key]; !ok {
-			logger.Printf("Cache extra outputs[%q] not found", key)
+			logger.Printf("Cache %s[%q] not found", title, key)
 			return false
 		}
 	}
@@ -322,6 +466,21 @@ func checkUpToDate(current, saved map[string]*fileEntry) error {
 	return nil
 }
 
+// writeFileAtomic writes data to a temporary sibling file and renames it to fn,
+// so readers never see a partially written file.
+func writeFileAtomic(fn string, data []byte, perm os.FileMode) error {
+	tmpFn := fn + ".tmp"
+	if err := os.WriteFile(tmpFn, data, perm); err != nil {
+		os.Remove(tmpFn)
+		return err
+	}
+	if err := os.Rename(tmpFn, fn); err != nil {
+		os.Remove(tmpFn)
+		return err
+	}
+	return nil
+}
+
 func loadStateFrom(stateFile string) (*fileCacheContent, error) {
 	data, err := os.ReadFile(stateFile)
 	if err != nil {
@@ -329,7 +488,10 @@ func loadStateFrom(stateFile string) (*fileCacheContent, error) {
 	}
 	var saved fileCacheContent
 	if err := json.Unmarshal(data, &saved); err != nil {
-		return nil, fmt.Errorf("parse state %q error: %w", stateFile, err)
+		return nil, fmt.Errorf("%w %q: %v", ErrCorrupt, stateFile, err)
+	}
+	if saved.Version > stateFileVersion {
+		return nil, fmt.Errorf("state %q version %d is newer than supported version %d", stateFile, saved.Version, stateFileVersion)
 	}
 	return &saved, nil
 }
@@ -0,0 +1,60 @@
+package repos
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"repos/pkg/repos/meta"
+)
+
+func newTestFilesCache(t *testing.T, dir string) *FilesCache {
+	project := &Project{Repo: &Repo{RootDir: dir}}
+	task := &Task{Target: &Target{Project: project, meta: &meta.Target{}}, name: "test:files"}
+	return NewFilesCache(&ToolExecContext{Task: task, CacheDir: dir, Logger: log.New(io.Discard, "", 0)})
+}
+
+func TestFilesCacheAddInputRecursiveFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestFilesCache(t, dir)
+	for _, fn := range []string{"file", "link"} {
+		if err := s.AddInput(fn, true); err != nil {
+			t.Fatalf("AddInput %q error: %v", fn, err)
+		}
+		if _, ok := s.current.Inputs[filepath.Join(dir, fn)]; !ok {
+			t.Errorf("%q not added as input", fn)
+		}
+	}
+}
+
+func TestFilesCacheAddInputRecursiveBrokenSymlink(t *testing.T) {
+	dir := t.TempDir()
+	subDir := filepath.Join(dir, "sub")
+	if err := os.Mkdir(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(subDir, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(subDir, "broken")); err != nil {
+		t.Fatal(err)
+	}
+	for _, followSymlinks := range []bool{false, true} {
+		s := newTestFilesCache(t, dir)
+		s.FollowSymlinks = followSymlinks
+		if err := s.AddInput("sub", true); err != nil {
+			t.Fatalf("AddInput with FollowSymlinks=%v error: %v", followSymlinks, err)
+		}
+		if _, ok := s.current.Inputs[filepath.Join(subDir, "file")]; !ok {
+			t.Errorf("file not added as input with FollowSymlinks=%v", followSymlinks)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package repos
+
+import "os"
+
+// lockFile is not supported on this platform.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is not supported on this platform.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -2,7 +2,12 @@ package repos
 
 import (
 	"container/list"
+	"context"
+	"errors"
 	"fmt"
+	"runtime"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -20,6 +25,7 @@ type Task struct {
 	Target    *Target
 	NoSkip    bool
 	DepOn     map[*Task]struct{}
+	WeakDepOn map[*Task]struct{}
 	DepBy     map[*Task]struct{}
 	DepDone   map[*Task]struct{}
 	State     TaskState
@@ -27,7 +33,15 @@ type Task struct {
 	StartTime time.Time
 	EndTime   time.Time
 	Outputs   *OutputFiles
+	Warnings  []string
 	Err       error
+
+	// name is the cached global name of the target.
+	name string
+	// cacheErrors is the number of failed cache operations in the last execution.
+	cacheErrors int
+	// completedBefore is the number of completed tasks when the task is enqueued.
+	completedBefore int
 }
 
 // OutputFiles specifies the output files as a result of the target.
@@ -37,9 +51,15 @@ type OutputFiles struct {
 	Primary string
 	// Extra provides additional files indexed by keys.
 	Extra map[string]string
+	// Dirs provides additional directories indexed by keys.
+	// The paths are not suffixed by path separator.
+	Dirs map[string]string
 	// GeneratedFiles are list of files generated in the source dir
 	// of the current task.
 	GeneratedFiles []string
+	// ArtifactURL references the remote artifact published by the task,
+	// e.g. a pushed docker image.
+	ArtifactURL string
 }
 
 // TaskState is the state of a task.
@@ -62,11 +82,14 @@ func BuildTaskGraph(r *Repo, requiredTargets ...string) (*TaskGraph, error) {
 	}
 	var resolveList list.List
 	for _, name := range requiredTargets {
-		tn := SplitTargetName(name)
-		if tn.Project == "" {
-			return nil, fmt.Errorf("not a global target name: %q", name)
+		tn, err := ParseTargetName(name)
+		if err != nil {
+			return nil, err
+		}
+		target, err := r.FindTarget(tn)
+		if err != nil {
+			return nil, err
 		}
-		target := r.FindTarget(tn)
 		if target == nil {
 			return nil, fmt.Errorf("unknown target %q", tn.GlobalName())
 		}
@@ -78,20 +101,31 @@ func BuildTaskGraph(r *Repo, requiredTargets ...string) (*TaskGraph, error) {
 		elm := resolveList.Front()
 		task := elm.Value.(*Task)
 		resolveList.Remove(elm)
-		for _, name := range task.Target.meta.Deps {
-			tn := SplitTargetName(name)
-			if tn.Project == "" {
-				tn.Project = task.Target.Name.Project
+		deps := task.Target.meta.Deps
+		numStrongDeps := len(deps)
+		deps = append(deps[:numStrongDeps:numStrongDeps], task.Target.meta.WeakDeps...)
+		for n, name := range deps {
+			weak := n >= numStrongDeps
+			depTarget, err := task.Target.resolveDependency(r, name)
+			if err != nil {
+				return nil, err
 			}
-			depTarget := r.FindTarget(tn)
 			if depTarget == nil {
-				return nil, fmt.Errorf("unknown dependency %q of target %q", name, task.Target.Name.GlobalName())
+				r.warnf("dependency %q of target %q is not available on %s", name, task.Target.Name.GlobalName(), runtime.GOOS)
+				continue
 			}
 			depTask, newTask := g.addTarget(depTarget)
 			if newTask {
 				resolveList.PushBack(depTask)
 			}
+			if _, exist := task.DepOn[depTask]; exist && weak {
+				// A strong dependency takes precedence.
+				continue
+			}
 			task.DepOn[depTask] = struct{}{}
+			if weak {
+				task.WeakDepOn[depTask] = struct{}{}
+			}
 			depTask.DepBy[task] = struct{}{}
 		}
 	}
@@ -105,7 +139,8 @@ func (g *TaskGraph) Prepare() map[*Task]struct{} {
 	g.ReadyList.Init()
 	g.CompleteList.Init()
 	var ready list.List
-	for _, task := range g.Tasks {
+	// Tasks are sorted so the initially ready tasks are dispatched in a stable order.
+	for _, task := range g.sortedTasks() {
 		task.State = TaskNotReady
 		task.DepDone = make(map[*Task]struct{})
 		task.Err = nil
@@ -117,6 +152,7 @@ func (g *TaskGraph) Prepare() map[*Task]struct{} {
 		}
 		notReady[task] = struct{}{}
 	}
+	g.warnSharedAlwaysTasks()
 	for ready.Len() > 0 {
 		elem := ready.Front()
 		task := elem.Value.(*Task)
@@ -133,19 +169,136 @@ func (g *TaskGraph) Prepare() map[*Task]struct{} {
 	return notReady
 }
 
+// warnSharedAlwaysTasks warns about tasks which can't be skipped but are
+// depended by multiple tasks, as these dependents will never be skipped either.
+func (g *TaskGraph) warnSharedAlwaysTasks() {
+	if g.Repo == nil {
+		return
+	}
+	for _, task := range g.sortedTasks() {
+		if !task.Target.Meta().Always || len(task.DepBy) < 2 {
+			continue
+		}
+		depBy := sortTasks(task.DepBy)
+		depNames := make([]string, 0, len(depBy))
+		for _, t := range depBy {
+			depNames = append(depNames, t.Name())
+		}
+		g.Repo.warnf("target %q always builds and is shared by %s, caching may not be optimal", task.Name(), strings.Join(depNames, ", "))
+	}
+}
+
+// ShortestCycle finds the shortest cycle of dependencies among the tasks,
+// usually returned by Prepare. The returned tasks are ordered so that each
+// depends on the next one and the last depends on the first.
+// It returns nil if there's no cycle.
+func (g *TaskGraph) ShortestCycle(tasks map[*Task]struct{}) []*Task {
+	var cycle []*Task
+	for _, start := range sortTasks(tasks) {
+		if path := shortestCycleFrom(start, tasks); path != nil && (cycle == nil || len(path) < len(cycle)) {
+			cycle = path
+		}
+	}
+	return cycle
+}
+
+// shortestCycleFrom searches breadth-first from start back to itself
+// only through the specified tasks.
+func shortestCycleFrom(start *Task, tasks map[*Task]struct{}) []*Task {
+	from := map[*Task]*Task{start: nil}
+	var queue list.List
+	queue.PushBack(start)
+	for queue.Len() > 0 {
+		elem := queue.Front()
+		queue.Remove(elem)
+		task := elem.Value.(*Task)
+		for _, dep := range sortTasks(task.DepOn) {
+			if _, ok := tasks[dep]; !ok {
+				continue
+			}
+			if dep == start {
+				var path []*Task
+				for t := task; t != nil; t = from[t] {
+					path = append([]*Task{t}, path...)
+				}
+				return path
+			}
+			if _, visited := from[dep]; !visited {
+				from[dep] = task
+				queue.PushBack(dep)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *TaskGraph) sortedTasks() []*Task {
+	names := make([]string, 0, len(g.Tasks))
+	for name := range g.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tasks := make([]*Task, 0, len(names))
+	for _, name := range names {
+		tasks = append(tasks, g.Tasks[name])
+	}
+	return tasks
+}
+
+// sortTasks returns the tasks in the set sorted by names.
+func sortTasks(set map[*Task]struct{}) []*Task {
+	tasks := make([]*Task, 0, len(set))
+	for task := range set {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name() < tasks[j].Name()
+	})
+	return tasks
+}
+
 // Complete marks a task completed and activates other tasks depending on it.
+//
+// If the task failed, the tasks strongly depending on it are abandoned: they
+// never run, and so are the tasks strongly depending on them, transitively.
+// A task weakly depending on a failed or abandoned task treats that
+// dependency as done, so it still runs once its other dependencies are done.
 func (g *TaskGraph) Complete(task *Task) {
 	task.State = TaskCompleted
 	g.CompleteList.PushBack(task)
-	if task.Failed() {
+	abandoned := make(map[*Task]struct{})
+	for depBy := range task.DepBy {
+		if task.Failed() && !depBy.WeakDep(task) {
+			g.abandon(depBy, abandoned)
+			continue
+		}
+		g.depDone(depBy, task)
+	}
+}
+
+// abandon releases the dependents of a task which will never run because a
+// strong dependency failed.
+func (g *TaskGraph) abandon(task *Task, abandoned map[*Task]struct{}) {
+	if _, ok := abandoned[task]; ok {
 		return
 	}
+	abandoned[task] = struct{}{}
 	for depBy := range task.DepBy {
-		depBy.DepDone[task] = struct{}{}
-		if len(depBy.DepDone) >= len(depBy.DepOn) {
-			g.ReadyList.PushBack(depBy)
-			depBy.State = TaskReady
+		if depBy.WeakDep(task) {
+			g.depDone(depBy, task)
+			continue
 		}
+		g.abandon(depBy, abandoned)
+	}
+}
+
+// depDone marks dep done for task and makes task ready when all of its
+// dependencies are done.
+func (g *TaskGraph) depDone(task, dep *Task) {
+	task.DepDone[dep] = struct{}{}
+	if task.State == TaskNotReady && len(task.DepDone) >= len(task.DepOn) {
+		g.ReadyList.PushBack(task)
+		task.State = TaskReady
 	}
 }
 
@@ -156,10 +309,12 @@ func (g *TaskGraph) addTarget(target *Target) (*Task, bool) {
 		return task, false
 	}
 	task = &Task{
-		Graph:  g,
-		Target: target,
-		DepOn:  make(map[*Task]struct{}),
-		DepBy:  make(map[*Task]struct{}),
+		Graph:     g,
+		Target:    target,
+		DepOn:     make(map[*Task]struct{}),
+		WeakDepOn: make(map[*Task]struct{}),
+		DepBy:     make(map[*Task]struct{}),
+		name:      name,
 	}
 	g.Tasks[name] = task
 	return task, true
@@ -167,7 +322,14 @@ func (g *TaskGraph) addTarget(target *Target) (*Task, bool) {
 
 // Name returns the global name of the target.
 func (t *Task) Name() string {
-	return t.Target.Name.GlobalName()
+	return t.name
+}
+
+// WeakDep indicates dep is a weak dependency of the task.
+// The failure of a weak dependency doesn't prevent the task from running.
+func (t *Task) WeakDep(dep *Task) bool {
+	_, ok := t.WeakDepOn[dep]
+	return ok
 }
 
 // Failed indicates the task failed.
@@ -175,6 +337,16 @@ func (t *Task) Failed() bool {
 	return t.Err != nil && t.Err != ErrSkipped
 }
 
+// FailedWithTimeout indicates the task failed because of a timeout.
+func (t *Task) FailedWithTimeout() bool {
+	return t.Failed() && errors.Is(t.Err, context.DeadlineExceeded)
+}
+
+// FailedWithCancel indicates the task failed because it was canceled.
+func (t *Task) FailedWithCancel() bool {
+	return t.Failed() && errors.Is(t.Err, context.Canceled)
+}
+
 // Skipped indicates the task is skipped.
 func (t *Task) Skipped() bool {
 	return t.Err == ErrSkipped
@@ -0,0 +1,26 @@
+package repos
+
+import "testing"
+
+var benchName string
+
+func BenchmarkTaskName(b *testing.B) {
+	g := &TaskGraph{Tasks: make(map[string]*Task)}
+	task, _ := g.addTarget(&Target{Name: TargetName{Project: "project", LocalName: "target"}})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchName = task.Name()
+	}
+}
+
+// BenchmarkTargetGlobalName is the baseline of BenchmarkTaskName
+// building the global name on every call.
+func BenchmarkTargetGlobalName(b *testing.B) {
+	name := TargetName{Project: "project", LocalName: "target"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchName = name.GlobalName()
+	}
+}
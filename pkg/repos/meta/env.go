@@ -0,0 +1,73 @@
+package meta
+
+import (
+	"fmt"
+	"os"
+)
+
+// EnvExpandOptions controls the substitution of environment variable
+// references (${VAR} or $VAR) in string values of metadata files.
+type EnvExpandOptions struct {
+	// AllowMissing leaves references to undefined variables unexpanded.
+	// Otherwise, loading fails on the first undefined variable.
+	AllowMissing bool
+}
+
+// EnvExpansion is the option used when loading metadata files.
+// References to undefined variables are preserved by default, so variables
+// only available at build time (e.g. REPOS_OUTPUT_DIR) still work in tool parameters.
+var EnvExpansion = EnvExpandOptions{AllowMissing: true}
+
+// expandEnv substitutes environment variable references in all string values
+// of the raw decoded content in place.
+func (o EnvExpandOptions) expandEnv(content map[string]interface{}) error {
+	for key, val := range content {
+		expanded, err := o.expandValue(val, key)
+		if err != nil {
+			return err
+		}
+		content[key] = expanded
+	}
+	return nil
+}
+
+func (o EnvExpandOptions) expandValue(val interface{}, path string) (interface{}, error) {
+	switch v := val.(type) {
+	case string:
+		return o.expandString(v, path)
+	case []interface{}:
+		for n, item := range v {
+			expanded, err := o.expandValue(item, fmt.Sprintf("%s[%d]", path, n))
+			if err != nil {
+				return nil, err
+			}
+			v[n] = expanded
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			expanded, err := o.expandValue(item, joinFieldPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	}
+	return val, nil
+}
+
+func (o EnvExpandOptions) expandString(s, path string) (string, error) {
+	var missing string
+	expanded := os.Expand(s, func(name string) string {
+		if val, ok := os.LookupEnv(name); ok {
+			return val
+		}
+		if missing == "" {
+			missing = name
+		}
+		return "${" + name + "}"
+	})
+	if missing != "" && !o.AllowMissing {
+		return "", fmt.Errorf("%s: undefined environment variable %q", path, missing)
+	}
+	return expanded, nil
+}
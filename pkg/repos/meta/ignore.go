@@ -0,0 +1,40 @@
+package meta
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the file at the root of a repository
+// specifying the paths to skip when looking for projects, in gitignore format.
+const IgnoreFile = ".reposignore"
+
+// LoadIgnoreFile loads the patterns from IgnoreFile in dir.
+// It returns nil if the file doesn't exist.
+func LoadIgnoreFile(dir string) ([]string, error) {
+	fn := filepath.Join(dir, IgnoreFile)
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %q error: %w", fn, err)
+	}
+	return patterns, nil
+}
@@ -1,43 +1,115 @@
 package meta
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/easeway/langx.go/mapper"
 )
 
-// LoadRootFromDir loads RootFile from the specified directory.
+// jsonDecoder implements mapper.Decoder for JSON.
+type jsonDecoder struct {
+}
+
+// tomlDecoder implements mapper.Decoder for TOML.
+type tomlDecoder struct {
+}
+
+// LoadRootFromDir loads the root file from the specified directory.
+// RootFileJSON, RootFile and RootFileTOML are searched in order.
 func LoadRootFromDir(dir string) (*Root, error) {
-	return LoadRootFile(filepath.Join(dir, RootFile))
+	fn, err := findFile(dir, RootFileJSON, RootFile, RootFileTOML)
+	if err != nil {
+		return nil, err
+	}
+	return LoadRootFile(fn)
 }
 
 // LoadRootFile loads RootFile from the specified file.
 func LoadRootFile(fn string) (*Root, error) {
 	var root Root
-	if err := loadAs(fn, &root); err != nil {
+	if err := loadAs(fn, &root, nil); err != nil {
 		return nil, err
 	}
 	return &root, nil
 }
 
+// FindProjectFile finds the project file in the specified meta-folder.
+// ProjectFileJSON, ProjectFile and ProjectFileTOML are searched in order.
+func FindProjectFile(dir string) (string, error) {
+	return findFile(dir, ProjectFileJSON, ProjectFile, ProjectFileTOML)
+}
+
 // LoadProjectFile loads Project from the specified file.
+// The content is validated against the schema, and a *ValidationError
+// is returned if unknown fields or mismatched types are found.
 func LoadProjectFile(fn string) (*Project, error) {
 	var project Project
-	if err := loadAs(fn, &project); err != nil {
+	if err := loadAs(fn, &project, validateSchema); err != nil {
 		return nil, err
 	}
 	return &project, nil
 }
 
-func loadAs(fn string, out interface{}) error {
+func findFile(dir string, names ...string) (string, error) {
+	for _, name := range names {
+		fn := filepath.Join(dir, name)
+		_, err := os.Stat(fn)
+		if err == nil {
+			return fn, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%s: %w", filepath.Join(dir, names[0]), os.ErrNotExist)
+}
+
+func loadAs(fn string, out interface{}, validate func(string, map[string]interface{}, interface{}) error) error {
 	var ld mapper.Loader
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".json":
+		ld.Decoder = &jsonDecoder{}
+	case ".toml":
+		ld.Decoder = &tomlDecoder{}
+	}
 	if err := ld.LoadFile(fn); err != nil {
 		return fmt.Errorf("load %s error: %w", fn, err)
 	}
+	if err := EnvExpansion.expandEnv(ld.Map); err != nil {
+		return fmt.Errorf("expand env in %s error: %w", fn, err)
+	}
+	if validate != nil {
+		if err := validate(fn, ld.Map, out); err != nil {
+			return err
+		}
+	}
 	m := mapper.Mapper{FieldTags: []string{"json", "map"}}
 	if err := m.Map(out, ld.Map); err != nil {
 		return fmt.Errorf("parse %s error: %w", fn, err)
 	}
 	return nil
 }
+
+// Decode implements mapper.Decoder.
+func (d *jsonDecoder) Decode(content []byte) (interface{}, error) {
+	var out interface{}
+	if err := json.Unmarshal(content, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Decode implements mapper.Decoder.
+func (d *tomlDecoder) Decode(content []byte) (interface{}, error) {
+	out := make(map[string]interface{})
+	if err := toml.Unmarshal(content, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
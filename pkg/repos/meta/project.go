@@ -3,6 +3,24 @@ package meta
 const (
 	// ProjectFile is filename under meta-folder.
 	ProjectFile = "project.yaml"
+	// ProjectFileTOML is the filename under meta-folder in TOML format.
+	// It's used if ProjectFile doesn't exist.
+	ProjectFileTOML = "project.toml"
+	// ProjectFileJSON is the filename under meta-folder in JSON format.
+	// It takes precedence over ProjectFile.
+	ProjectFileJSON = "project.json"
+)
+
+// Values of Target.Visibility.
+const (
+	// VisibilityPublic allows the target to be depended on by any target.
+	VisibilityPublic = "public"
+	// VisibilityInternal allows the target to be depended on by targets in the
+	// same project or projects in the sub-directories of the project.
+	VisibilityInternal = "internal"
+	// VisibilityPrivate allows the target to be depended on by targets in the
+	// same project only.
+	VisibilityPrivate = "private"
 )
 
 // Project is the schema of meta-folder/ProjectFile.
@@ -11,11 +29,17 @@ type Project struct {
 	Name string `json:"name"`
 	// Description is the details of the project.
 	Description string `json:"description,omitempty"`
+	// Version is the semantic version of the project.
+	Version string `json:"version,omitempty"`
+	// DefaultDeps specifies the dependencies applied to every target in this project.
+	// A default dependency is not applied to the target itself.
+	DefaultDeps []string `json:"default-deps,omitempty"`
 	// Targets specifies all the targets in this project.
 	Targets map[string]*Target `json:"targets,omitempty"`
 	// Includes specifies additional sources to merge.
 	// The value must be a filename relative to the folder containing the
-	// main project file.
+	// main project file. Included files may include other files, but circular
+	// includes are not allowed.
 	Includes []string `json:"includes,omitempty"`
 }
 
@@ -25,6 +49,9 @@ type Target struct {
 	Description string `json:"description,omitempty"`
 	// Deps specifies the dependencies.
 	Deps []string `json:"deps,omitempty"`
+	// WeakDeps specifies the dependencies built before this target,
+	// but their failures don't prevent this target from building.
+	WeakDeps []string `json:"weak-deps,omitempty"`
 	// Launch indicates if this target is for launching a process.
 	Launch bool `json:"launch,omitempty"`
 	// Always specifies this target can't be skipped.
@@ -32,6 +59,12 @@ type Target struct {
 	// SubDir indicates the tool should operate in the relative path under
 	// the project directory.
 	SubDir string `json:"subdir,omitempty"`
+	// Visibility controls which targets can depend on this target.
+	// It's one of VisibilityPublic (default), VisibilityInternal and VisibilityPrivate.
+	Visibility string `json:"visibility,omitempty"`
+	// Platform specifies the platforms (values of GOOS, e.g. linux, darwin, windows)
+	// this target is available on. If empty, the target is available on all platforms.
+	Platform []string `json:"platform,omitempty"`
 	// RegisterTool indicates an external tool is registered using the output of this target.
 	RegisterTool *ToolRegistration `json:"register-tool,omitempty"`
 	// Rule specifies the tool and parameters of the tool to execute this target.
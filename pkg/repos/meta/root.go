@@ -3,6 +3,12 @@ package meta
 const (
 	// RootFile defines the Root metadata file name.
 	RootFile = "REPOS.yaml"
+	// RootFileTOML is the Root metadata file name in TOML format.
+	// It's used if RootFile doesn't exist.
+	RootFileTOML = "REPOS.toml"
+	// RootFileJSON is the Root metadata file name in JSON format.
+	// It takes precedence over RootFile.
+	RootFileJSON = "REPOS.json"
 
 	// DefaultDataDir is the default directory name for data.
 	DefaultDataDir = ".repos_data"
@@ -20,7 +26,37 @@ type Root struct {
 	MetaFolder string `json:"meta-folder,omitempty"`
 	// ProjectPathExclude specifies the pattern to skip certain paths when looking for projects.
 	ProjectPathExclude []string `json:"project-path-exclude,omitempty"`
+	// ProjectPathInclude specifies the pattern to only accept certain paths when looking for projects.
+	// If not empty, a project is loaded only if its path matches one of the patterns,
+	// and ProjectPathExclude still applies.
+	ProjectPathInclude []string `json:"project-path-include,omitempty"`
 	// AbsoluteRoot when set to true, prevents the folder containing RootFile from being merged
-	//  in the ancestor folder containing a RootFile as part of a bigger project.
-	AbsoluteRoot bool `json:"allow-parent,omitempty"`
+	// in the ancestor folder containing a RootFile as part of a bigger project.
+	// The parent directories are not searched for another RootFile.
+	AbsoluteRoot bool `json:"absolute-root,omitempty"`
+	// FollowSymlinks when set to true, follows symbolic links to directories
+	// when looking for projects.
+	FollowSymlinks bool `json:"follow-symlinks,omitempty"`
+	// DefaultEnv specifies environment variables applied to all task executions.
+	// Values are templates rendered the same way as tool parameters.
+	// Environment variables specified by a target override these.
+	DefaultEnv map[string]string `json:"default-env,omitempty"`
+	// MaxWorkers specifies the default number of parallel workers.
+	// If not specified, the number of CPUs is used.
+	MaxWorkers int `json:"max-workers,omitempty"`
+	// Hooks specifies shell commands to run around a build.
+	Hooks BuildHooks `json:"hooks,omitempty"`
+	// Shell specifies the shell program for executing command lines.
+	// If not specified, $SHELL is used, or /bin/sh if $SHELL is not set.
+	Shell string `json:"shell,omitempty"`
+}
+
+// BuildHooks defines shell commands to run before and after a build.
+// The commands run in the root directory of the repository.
+type BuildHooks struct {
+	// PreBuild runs once before any task starts. The build is aborted if it fails.
+	PreBuild string `json:"pre-build,omitempty"`
+	// PostBuild runs after all tasks complete regardless of the result.
+	// Environment variable REPOS_BUILD_RESULT is set to "ok" or "failed".
+	PostBuild string `json:"post-build,omitempty"`
 }
@@ -0,0 +1,178 @@
+package meta
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidationError contains all violations found when validating a metadata
+// file against its schema.
+type ValidationError struct {
+	// FileName is the file (or a description of the content) being validated.
+	FileName string
+	// Violations lists the problems, each prefixed by the path of the field.
+	Violations []string
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s:\n  %s", e.FileName, strings.Join(e.Violations, "\n  "))
+}
+
+// validateSchema checks the decoded content against the schema type of out.
+// It reports unknown fields and type mismatches.
+func validateSchema(fn string, content map[string]interface{}, out interface{}) error {
+	v := &schemaValidator{checkTypes: true}
+	v.validateValue(reflect.TypeOf(out), content, "")
+	return v.result(fn)
+}
+
+// ValidateUnknownFields checks the decoded content against the schema type
+// of out and only reports unknown fields. Type mismatches are left to the
+// decoder. The returned error is a *ValidationError using name as FileName.
+func ValidateUnknownFields(name string, content interface{}, out interface{}) error {
+	v := &schemaValidator{}
+	v.validateValue(reflect.TypeOf(out), content, "")
+	return v.result(name)
+}
+
+type schemaValidator struct {
+	checkTypes bool
+	violations []string
+}
+
+func (v *schemaValidator) result(fn string) error {
+	if len(v.violations) > 0 {
+		return &ValidationError{FileName: fn, Violations: v.violations}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateValue(t reflect.Type, val interface{}, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if val == nil || t.Kind() == reflect.Interface {
+		return
+	}
+	mismatch := func(expected string) {
+		if v.checkTypes {
+			v.violations = append(v.violations, fmt.Sprintf("%s: expect %s, got %s", fieldPath(path), expected, valueKind(val)))
+		}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		if _, ok := val.(string); !ok {
+			mismatch("string")
+		}
+	case reflect.Bool:
+		if _, ok := val.(bool); !ok {
+			mismatch("bool")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !isInteger(val) {
+			mismatch("integer")
+		}
+	case reflect.Slice:
+		items, ok := val.([]interface{})
+		if !ok {
+			mismatch("list")
+			return
+		}
+		for n, item := range items {
+			v.validateValue(t.Elem(), item, fmt.Sprintf("%s[%d]", path, n))
+		}
+	case reflect.Map:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			mismatch("map")
+			return
+		}
+		for _, key := range sortedKeys(m) {
+			v.validateValue(t.Elem(), m[key], joinFieldPath(path, key))
+		}
+	case reflect.Struct:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			mismatch("map")
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			if name := jsonFieldName(t.Field(i)); name != "" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for _, key := range sortedKeys(m) {
+			fieldType, ok := fields[key]
+			if !ok {
+				v.violations = append(v.violations, fmt.Sprintf("%s: unknown field", fieldPath(joinFieldPath(path, key))))
+				continue
+			}
+			v.validateValue(fieldType, m[key], joinFieldPath(path, key))
+		}
+	}
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+func isInteger(val interface{}) bool {
+	switch v := val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	case float64:
+		return v == float64(int64(v))
+	}
+	return false
+}
+
+func valueKind(val interface{}) string {
+	switch val.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return reflect.TypeOf(val).Kind().String()
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func fieldPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
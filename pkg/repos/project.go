@@ -1,9 +1,12 @@
 package repos
 
 import (
-	"container/list"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/easeway/langx.go/mapper"
@@ -20,8 +23,11 @@ type Project struct {
 	// Dir is the relative path from root of the repo.
 	Dir string
 
-	meta    *meta.Project
-	targets map[string]*Target
+	fileName string
+	meta     *meta.Project
+	targets  map[string]*Target
+	// platformSkipped contains targets not available on current platform.
+	platformSkipped map[string]*meta.Target
 }
 
 // Target represents a target in a project.
@@ -57,66 +63,137 @@ func SplitTargetName(name string) TargetName {
 	return TargetName{Project: items[0], LocalName: items[1]}
 }
 
+// ParseTargetName parses a global target name in the form of PROJECT:TARGET.
+// Unlike SplitTargetName, it returns an error if either part is missing.
+func ParseTargetName(name string) (TargetName, error) {
+	items := strings.SplitN(name, ":", 2)
+	if len(items) == 2 {
+		if tn := (TargetName{Project: items[0], LocalName: items[1]}); tn.IsValid() {
+			return tn, nil
+		}
+	}
+	return TargetName{}, fmt.Errorf("not a global target name: %q", name)
+}
+
+// IsValid determines whether both project and local name are present.
+func (n TargetName) IsValid() bool {
+	return n.Project != "" && n.LocalName != ""
+}
+
 // GlobalName returns the global name of the target.
-// If Project is empty, the returned global name is invalid.
+// If the name is not valid, the returned global name is invalid.
 func (n TargetName) GlobalName() string {
 	return n.Project + ":" + n.LocalName
 }
 
+// MustGlobalName is similar to GlobalName but panics if the name is not valid.
+func (n TargetName) MustGlobalName() string {
+	if !n.IsValid() {
+		panic(fmt.Sprintf("invalid target name: project %q, local name %q", n.Project, n.LocalName))
+	}
+	return n.GlobalName()
+}
+
 func mergeMetaTargets(targets, from map[string]*meta.Target) {
 	for name, target := range from {
 		targets[name] = target
 	}
 }
 
+// loadIncludes merges targets from project and included files recursively.
+// The value in includeFiles is false when the file is being processed, and true
+// when it's done, so circular includes can be detected.
+func loadIncludes(metaDir, fn string, project *meta.Project, targets map[string]*meta.Target, includeFiles map[string]bool) error {
+	includeFiles[fn] = false
+	mergeMetaTargets(targets, project.Targets)
+	for _, includeFile := range project.Includes {
+		includeFile = filepath.Clean(includeFile)
+		if done, ok := includeFiles[includeFile]; ok {
+			if !done {
+				return fmt.Errorf("circular include %q from %q", includeFile, filepath.Join(metaDir, fn))
+			}
+			continue
+		}
+		incProject, err := meta.LoadProjectFile(filepath.Join(metaDir, includeFile))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Not wrapping os.ErrNotExist, otherwise the project is silently ignored.
+				return fmt.Errorf("included file %q from %q not found", includeFile, filepath.Join(metaDir, fn))
+			}
+			return err
+		}
+		if err := loadIncludes(metaDir, includeFile, incProject, targets, includeFiles); err != nil {
+			return err
+		}
+	}
+	includeFiles[fn] = true
+	return nil
+}
+
+func availableOnPlatform(platforms []string, goos string) bool {
+	if len(platforms) == 0 {
+		return true
+	}
+	for _, platform := range platforms {
+		if platform == goos {
+			return true
+		}
+	}
+	return false
+}
+
 func loadProject(r *Repo, relPath string) (*Project, error) {
-	fn := filepath.Join(r.RootDir, relPath, r.metaFolder, meta.ProjectFile)
+	metaDir := filepath.Join(r.RootDir, relPath, r.metaFolder)
+	fn, err := meta.FindProjectFile(metaDir)
+	if err != nil {
+		return nil, err
+	}
 	project, err := meta.LoadProjectFile(fn)
 	if err != nil {
 		return nil, err
 	}
 	p := &Project{
-		Repo:    r,
-		Dir:     relPath,
-		Name:    project.Name,
-		meta:    project,
-		targets: make(map[string]*Target),
+		Repo:     r,
+		Dir:      relPath,
+		Name:     project.Name,
+		fileName: filepath.Base(fn),
+		meta:     project,
+		targets:  make(map[string]*Target),
+
+		platformSkipped: make(map[string]*meta.Target),
 	}
 	if p.Name == "" {
 		return nil, fmt.Errorf("missing project name: %q", fn)
 	}
+	for n, dep := range project.DefaultDeps {
+		if SplitTargetName(dep).LocalName == "" {
+			return nil, fmt.Errorf("project %q: invalid default-deps[%d]: %q", p.Name, n, dep)
+		}
+	}
 
 	targets := make(map[string]*meta.Target)
-
-	// Processing includes.
-	var incProjects list.List
-	incProjectFiles := make(map[string]*meta.Project)
-	incProjects.PushBack(project)
-	incProjectFiles[meta.ProjectFile] = project
-	for incProjects.Len() > 0 {
-		elem := incProjects.Front()
-		project := elem.Value.(*meta.Project)
-		incProjects.Remove(elem)
-		mergeMetaTargets(targets, project.Targets)
-		for _, includeFile := range p.meta.Includes {
-			if incProjectFiles[includeFile] != nil {
-				continue
-			}
-			project, err = meta.LoadProjectFile(filepath.Join(r.RootDir, relPath, r.metaFolder, includeFile))
-			if err != nil {
-				return nil, err
-			}
-			incProjects.PushBack(project)
-			incProjectFiles[includeFile] = project
-		}
+	if err := loadIncludes(metaDir, p.fileName, project, targets, make(map[string]bool)); err != nil {
+		return nil, err
 	}
 
 	for name, targetMeta := range targets {
+		if !availableOnPlatform(targetMeta.Platform, runtime.GOOS) {
+			p.platformSkipped[name] = targetMeta
+			continue
+		}
+		if len(project.DefaultDeps) > 0 {
+			targetMeta.Deps = append(p.defaultDepsOf(name), targetMeta.Deps...)
+		}
 		target := &Target{
 			Project: p,
 			Name:    TargetName{Project: p.Name, LocalName: name},
 			meta:    targetMeta,
 		}
+		switch targetMeta.Visibility {
+		case "", meta.VisibilityPublic, meta.VisibilityInternal, meta.VisibilityPrivate:
+		default:
+			return nil, fmt.Errorf("target %q: invalid visibility %q", target.Name.GlobalName(), targetMeta.Visibility)
+		}
 		if err := CreateToolExecutor(target); err != nil {
 			return nil, fmt.Errorf("create tool for target %q error: %w", target.Name.GlobalName(), err)
 		}
@@ -157,9 +234,22 @@ func loadProject(r *Repo, relPath string) (*Project, error) {
 	return p, nil
 }
 
+// defaultDepsOf returns default dependencies excluding the target itself.
+func (p *Project) defaultDepsOf(localName string) []string {
+	deps := make([]string, 0, len(p.meta.DefaultDeps))
+	for _, dep := range p.meta.DefaultDeps {
+		tn := SplitTargetName(dep)
+		if (tn.Project == "" || tn.Project == p.Name) && tn.LocalName == localName {
+			continue
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
 // FileName returns the project file name with relative path.
 func (p *Project) FileName() string {
-	return filepath.Join(p.Dir, meta.ProjectFile)
+	return filepath.Join(p.Dir, p.fileName)
 }
 
 // Meta returns the metadata of the project.
@@ -186,11 +276,87 @@ func (p *Project) Targets() []*Target {
 	return targets
 }
 
+// TargetsSorted returns the targets defined by the project sorted by local names.
+func (p *Project) TargetsSorted() []*Target {
+	targets := p.Targets()
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Name.LocalName < targets[j].Name.LocalName
+	})
+	return targets
+}
+
 // Meta returns the metadata of the target.
 func (t *Target) Meta() meta.Target {
 	return *t.meta
 }
 
+// VisibleTo determines whether the target can be depended on by the specified target.
+func (t *Target) VisibleTo(from *Target) bool {
+	if from.Project == t.Project {
+		return true
+	}
+	switch t.meta.Visibility {
+	case meta.VisibilityPrivate:
+		return false
+	case meta.VisibilityInternal:
+		return t.Project.Dir == "" || strings.HasPrefix(from.Project.Dir, t.Project.Dir+string(filepath.Separator))
+	}
+	return true
+}
+
+// Dependencies resolves the dependencies (including weak ones) of the target.
+// Dependencies not available on the current platform are omitted.
+func (t *Target) Dependencies(r *Repo) ([]*Target, error) {
+	names := append(t.meta.Deps[:len(t.meta.Deps):len(t.meta.Deps)], t.meta.WeakDeps...)
+	deps := make([]*Target, 0, len(names))
+	for _, name := range names {
+		dep, err := t.resolveDependency(r, name)
+		if err != nil {
+			return nil, err
+		}
+		if dep != nil {
+			deps = append(deps, dep)
+		}
+	}
+	return deps, nil
+}
+
+// CheckDependencies resolves all dependencies of the target and returns an
+// error for each of those can't be resolved.
+func (t *Target) CheckDependencies(r *Repo) []error {
+	var errs []error
+	for _, name := range append(t.meta.Deps[:len(t.meta.Deps):len(t.meta.Deps)], t.meta.WeakDeps...) {
+		if _, err := t.resolveDependency(r, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// resolveDependency resolves a dependency name, which is relative to the
+// project of the target if it's a local name. It returns nil without error if
+// the dependency is not available on the current platform.
+func (t *Target) resolveDependency(r *Repo, name string) (*Target, error) {
+	tn := SplitTargetName(name)
+	if tn.Project == "" {
+		tn.Project = t.Name.Project
+	}
+	dep, err := r.FindTarget(tn)
+	if err != nil {
+		return nil, fmt.Errorf("dependency %q of target %q: %w", name, t.Name.GlobalName(), err)
+	}
+	if dep == nil {
+		if r.PlatformSkipped(tn) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unknown dependency %q of target %q", name, t.Name.GlobalName())
+	}
+	if !dep.VisibleTo(t) {
+		return nil, fmt.Errorf("dependency %q of target %q is %s", name, t.Name.GlobalName(), dep.meta.Visibility)
+	}
+	return dep, nil
+}
+
 // ProjectDir returns full path to project directory.
 func (t *Target) ProjectDir() string {
 	return filepath.Join(t.Project.Repo.RootDir, t.Project.Dir)
@@ -220,6 +386,15 @@ func (t *Target) ToolParamsAs(out interface{}) error {
 	return m.Map(out, t.toolParams)
 }
 
+// ToolParamsAsStrict is similar to ToolParamsAs but rejects parameters not
+// defined by the specified type with a *meta.ValidationError.
+func (t *Target) ToolParamsAsStrict(out interface{}) error {
+	if err := meta.ValidateUnknownFields(fmt.Sprintf("params of target %s", t.Name.GlobalName()), t.toolParams, out); err != nil {
+		return err
+	}
+	return t.ToolParamsAs(out)
+}
+
 // Tool returns pre-created built-in tool.
 // If a tool is created, true is returned with the tool.
 // dummy tool (without rule) is returned as nil with true.
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/karrick/godirwalk"
@@ -40,12 +42,19 @@ type Repo struct {
 	RootDir string
 	// WorkDir is the absolute path of current working directory (may be different from PWD).
 	WorkDir string
+	// WarningHandler receives warning messages. Warnings are discarded if it's nil.
+	WarningHandler func(msg string)
+	// OutBaseDir overrides the base output directory if not empty.
+	// It must be an absolute path.
+	OutBaseDir string
 
 	root           *meta.Root
 	dataDir        string
 	metaFolder     string
 	projects       map[string]*Project
 	currentProject *Project
+	// excludePatterns combines ProjectPathExclude and patterns in meta.IgnoreFile.
+	excludePatterns []string
 }
 
 // NewRepo creates a Repo from the specified directory as working directory.
@@ -92,7 +101,15 @@ func (r *Repo) LocateRoot(scope RepoScope) error {
 	if root == nil {
 		return fmt.Errorf("find %s from %q failed: %w", meta.RootFile, r.WorkDir, os.ErrNotExist)
 	}
-	return r.updateMeta(root)
+	if err := r.updateMeta(root); err != nil {
+		return err
+	}
+	ignorePatterns, err := meta.LoadIgnoreFile(r.RootDir)
+	if err != nil {
+		return fmt.Errorf("load %s error: %w", meta.IgnoreFile, err)
+	}
+	r.excludePatterns = append(append([]string(nil), root.ProjectPathExclude...), ignorePatterns...)
+	return nil
 }
 
 // LoadProjects scans the repository to populate all projects.
@@ -104,11 +121,15 @@ func (r *Repo) LoadProjects() error {
 
 	projects := make(map[string]*Project)
 	suffix := string(filepath.Separator) + r.metaFolder
-	err := walkDirs(r.RootDir, func(relPath string, isDir bool) error {
+	err := walkDirs(r.RootDir, r.root.FollowSymlinks, func(relPath string, isDir bool) error {
 		if !isDir {
 			return nil
 		}
 		if !strings.HasSuffix(relPath, suffix) {
+			// Prune the directories which can't contain any included project.
+			if len(r.root.ProjectPathInclude) > 0 && relPath != "/" && !r.mayIncludeProjects(relPath[1:]) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 		var dir string
@@ -116,7 +137,19 @@ func (r *Repo) LoadProjects() error {
 			dir = relPath[1:left]
 		}
 		// Match gitignore pattern is expensive.
-		for _, pattern := range r.root.ProjectPathExclude {
+		if len(r.root.ProjectPathInclude) > 0 {
+			included := false
+			for _, pattern := range r.root.ProjectPathInclude {
+				if gitignore.Match(pattern, relPath) || gitignore.Match(pattern, dir) {
+					included = true
+					break
+				}
+			}
+			if !included {
+				return filepath.SkipDir
+			}
+		}
+		for _, pattern := range r.excludePatterns {
 			if gitignore.Match(pattern, relPath) || gitignore.Match(pattern, dir) {
 				return filepath.SkipDir
 			}
@@ -144,17 +177,97 @@ func (r *Repo) LoadProjects() error {
 	return nil
 }
 
+// mayIncludeProjects indicates whether projects can be found under dir,
+// that's dir either matches a pattern in ProjectPathInclude or is an ancestor
+// of paths matching a pattern.
+func (r *Repo) mayIncludeProjects(dir string) bool {
+	dir = filepath.ToSlash(dir)
+	dirParts := strings.Split(dir, "/")
+	for _, pattern := range r.root.ProjectPathInclude {
+		if gitignore.Match(pattern, dir) {
+			return true
+		}
+		pattern = strings.Trim(pattern, "/")
+		// Patterns without slash match at any level,
+		// and "**" matches any number of directories.
+		if !strings.Contains(pattern, "/") || strings.Contains(pattern, "**") {
+			return true
+		}
+		patternParts := strings.Split(pattern, "/")
+		if len(dirParts) >= len(patternParts) {
+			continue
+		}
+		ancestor := true
+		for n, part := range dirParts {
+			if matched, err := path.Match(patternParts[n], part); err != nil || !matched {
+				ancestor = false
+				break
+			}
+		}
+		if ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// PlatformSkipped indicates the target is defined but not available on current platform.
+func (r *Repo) PlatformSkipped(name TargetName) bool {
+	if p := r.FindProject(name.Project); p != nil {
+		_, ok := p.platformSkipped[name.LocalName]
+		return ok
+	}
+	return false
+}
+
+func (r *Repo) warnf(format string, args ...interface{}) {
+	if r.WarningHandler != nil {
+		r.WarningHandler(fmt.Sprintf(format, args...))
+	}
+}
+
 // FindProject finds the project by name.
 func (r *Repo) FindProject(name string) *Project {
 	return r.projects[name]
 }
 
 // FindTarget find a target by global name.
-func (r *Repo) FindTarget(name TargetName) *Target {
+// If there's no exact match, the name is matched case-insensitively with a warning,
+// and ErrAmbiguousMatch is returned if more than one targets are matched.
+// It returns nil without error if no target is found.
+func (r *Repo) FindTarget(name TargetName) (*Target, error) {
 	if p := r.FindProject(name.Project); p != nil {
-		return p.FindTarget(name.LocalName)
+		if target := p.FindTarget(name.LocalName); target != nil {
+			return target, nil
+		}
 	}
-	return nil
+	if r.PlatformSkipped(name) {
+		return nil, nil
+	}
+	var matched []*Target
+	for projectName, project := range r.projects {
+		if !strings.EqualFold(projectName, name.Project) {
+			continue
+		}
+		for localName, target := range project.targets {
+			if strings.EqualFold(localName, name.LocalName) {
+				matched = append(matched, target)
+			}
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, nil
+	case 1:
+		r.warnf("%s matched case-insensitively, did you mean %s", name.GlobalName(), matched[0].Name.GlobalName())
+		return matched[0], nil
+	}
+	names := make([]string, 0, len(matched))
+	for _, target := range matched {
+		names = append(names, target.Name.GlobalName())
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("%w: %q matches %s case-insensitively", ErrAmbiguousMatch, name.GlobalName(), strings.Join(names, ", "))
 }
 
 // Projects returns loaded projects in a copied slice.
@@ -166,14 +279,46 @@ func (r *Repo) Projects() []*Project {
 	return projects
 }
 
+// WalkProjects calls fn on each loaded project in no particular order
+// without copying. It stops and returns the error returned by fn.
+func (r *Repo) WalkProjects(fn func(*Project) error) error {
+	for _, project := range r.projects {
+		if err := fn(project); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkTargets calls fn on each target of all loaded projects in no particular
+// order without copying. It stops and returns the error returned by fn.
+func (r *Repo) WalkTargets(fn func(*Target) error) error {
+	for _, project := range r.projects {
+		for _, target := range project.targets {
+			if err := fn(target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // CurrentProject returns the project whose folder is the closest parent folder
 // of the working directory. It can be nil if no such folder exists.
 func (r *Repo) CurrentProject() *Project {
 	return r.currentProject
 }
 
+// Meta returns the metadata of the repository root.
+func (r *Repo) Meta() meta.Root {
+	return *r.root
+}
+
 // OutDir returns the base output directory.
 func (r *Repo) OutDir() string {
+	if r.OutBaseDir != "" {
+		return r.OutBaseDir
+	}
 	return filepath.Join(r.dataDir, outFolderName)
 }
 
@@ -190,19 +335,21 @@ func (r *Repo) Plan(requiredTargets ...string) (*TaskGraph, error) {
 	}
 	cyclicTasks := g.Prepare()
 	if len(cyclicTasks) > 0 {
-		names := make([]string, 0, len(cyclicTasks))
-		for task := range cyclicTasks {
+		cycle := g.ShortestCycle(cyclicTasks)
+		names := make([]string, 0, len(cycle)+1)
+		for _, task := range cycle {
 			names = append(names, task.Name())
 		}
-		return nil, fmt.Errorf("cyclic dependencies in %s", strings.Join(names, ","))
+		names = append(names, cycle[0].Name())
+		return nil, fmt.Errorf("cyclic dependency: %s", strings.Join(names, " -> "))
 	}
 	return g, nil
 }
 
 // LoadTaskResult loads task result.
 func (r *Repo) LoadTaskResult(taskName string) (*TaskResult, error) {
-	fn := filepath.Join(r.dataDir, cacheFolderName, taskName+".result")
-	return loadTaskResultFrom(fn)
+	store := &FileResultStore{Dir: filepath.Join(r.dataDir, cacheFolderName)}
+	return store.Load(taskName)
 }
 
 // LoadTaskOutputs loads task outputs from saved state.
@@ -221,6 +368,9 @@ func (r *Repo) LoadTaskOutputs(taskName string) (*OutputFiles, error) {
 // project name and the other for matching target name. E.g. "public.*:gen-*".
 // For matching project names, the following rules apply:
 // - With wildcard, project names are matched using filepath.Match;
+// - With "**", it matches zero or more path segments separated by "/" in either
+//     project names or project directories, e.g. "**" matches all projects, and
+//     "myapp/**" matches projects in directory "myapp" and its sub-directories;
 // - Empty string, the current project (the closest project folder in the parents
 //     of current working directory) is matched. It fails if no current project
 //     is available;
@@ -259,7 +409,7 @@ func (r *Repo) ResolveTargets(pattern string) ([]*Target, error) {
 			projects = append(projects, project)
 		} else {
 			for name, project := range r.projects {
-				matched, err := filepath.Match(projectPattern, name)
+				matched, err := matchProjectPattern(projectPattern, project, name)
 				if err != nil {
 					return nil, fmt.Errorf("%w: %q for projects", err, projectPattern)
 				}
@@ -293,7 +443,19 @@ func (r *Repo) ResolveTargets(pattern string) ([]*Target, error) {
 	}
 
 	if targetList.Len() == 0 {
-		return nil, nil
+		if onlyMatchTargets || strings.ContainsAny(pattern, "*?[\\") {
+			return nil, nil
+		}
+		// Literal target name may differ in letter case.
+		name := TargetName{Project: strings.TrimSpace(items[0]), LocalName: targetPattern}
+		if !name.IsValid() {
+			name.Project = projects[0].Name
+		}
+		target, err := r.FindTarget(name)
+		if target == nil || err != nil {
+			return nil, err
+		}
+		return []*Target{target}, nil
 	}
 
 	targets := make([]*Target, 0, targetList.Len())
@@ -308,7 +470,44 @@ func (r *Repo) ResolveTargets(pattern string) ([]*Target, error) {
 	return targets, nil
 }
 
-// ResolveTargetNames resolves multiple patterns into a list of target names.
+func matchProjectPattern(pattern string, project *Project, name string) (bool, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Match(pattern, name)
+	}
+	patternSegs := strings.Split(pattern, "/")
+	matched, err := matchGlobstar(patternSegs, strings.Split(name, "/"))
+	if matched || err != nil {
+		return matched, err
+	}
+	return matchGlobstar(patternSegs, strings.Split(filepath.ToSlash(project.Dir), "/"))
+}
+
+// matchGlobstar matches path segments where "**" matches zero or more segments
+// and other segments are matched using path.Match.
+func matchGlobstar(pattern, segs []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for n := 0; n <= len(segs); n++ {
+				if matched, err := matchGlobstar(pattern[1:], segs[n:]); matched || err != nil {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(segs) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(pattern[0], segs[0])
+		if !matched || err != nil {
+			return false, err
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0, nil
+}
+
+// ResolveTargetNames resolves multiple patterns into a list of deduplicated
+// target names in no particular order.
 func (r *Repo) ResolveTargetNames(patterns ...string) ([]string, error) {
 	targetSet := make(map[*Target]struct{})
 	for _, pattern := range patterns {
@@ -327,6 +526,17 @@ func (r *Repo) ResolveTargetNames(patterns ...string) ([]string, error) {
 	return names, nil
 }
 
+// ResolveTargetNamesSorted is the same as ResolveTargetNames but the names
+// are sorted lexicographically.
+func (r *Repo) ResolveTargetNamesSorted(patterns ...string) ([]string, error) {
+	names, err := r.ResolveTargetNames(patterns...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 func (r *Repo) updateMeta(root *meta.Root) error {
 	r.root = root
 	dataDir := root.DataDir
@@ -337,19 +547,87 @@ func (r *Repo) updateMeta(root *meta.Root) error {
 	if r.metaFolder = root.MetaFolder; r.metaFolder == "" {
 		r.metaFolder = meta.DefaultMetaFolder
 	}
+	if root.MaxWorkers < 0 {
+		return fmt.Errorf("invalid max-workers %d", root.MaxWorkers)
+	}
+	if _, err := r.defaultEnvTemplates(); err != nil {
+		return err
+	}
 	return nil
 }
 
-func walkDirs(baseDir string, callback func(string, bool) error) error {
+// ShellProgram returns the shell for executing command lines.
+// The shell specified in root metadata takes precedence over $SHELL.
+func (r *Repo) ShellProgram() string {
+	if r.root != nil && r.root.Shell != "" {
+		return r.root.Shell
+	}
+	return ShellProgram()
+}
+
+// defaultEnvTemplates parses DefaultEnv from root metadata.
+// Templates are created every time as they are not safe to be rendered concurrently.
+func (r *Repo) defaultEnvTemplates() ([]*ToolParamTemplate, error) {
+	templates := make([]*ToolParamTemplate, 0, len(r.root.DefaultEnv))
+	for key, val := range r.root.DefaultEnv {
+		tpl, err := NewToolParamTemplate(key + "=" + val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default-env %s: %w", key, err)
+		}
+		templates = append(templates, tpl)
+	}
+	return templates, nil
+}
+
+func walkDirs(baseDir string, followSymlinks bool, callback func(string, bool) error) error {
 	baseDir = filepath.Clean(baseDir)
+	// visitedDirs are the real paths of the trees being walked,
+	// used to detect cycles when following symbolic links.
+	var visitedDirs []string
+	if followSymlinks {
+		realBaseDir, err := filepath.EvalSymlinks(baseDir)
+		if err != nil {
+			return err
+		}
+		visitedDirs = append(visitedDirs, realBaseDir)
+	}
 	return godirwalk.Walk(baseDir, &godirwalk.Options{
 		Callback: func(path string, entry *godirwalk.Dirent) error {
 			relPath := path[len(baseDir):]
 			if relPath == "" {
 				relPath = "/"
 			}
-			return callback(relPath, entry.IsDir())
+			isDir := entry.IsDir()
+			if followSymlinks && entry.IsSymlink() {
+				realPath, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					// Ignore broken symbolic links.
+					return nil
+				}
+				if info, err := os.Stat(realPath); err != nil || !info.IsDir() {
+					return callback(relPath, false)
+				}
+				for _, dir := range visitedDirs {
+					if realPath == dir ||
+						strings.HasPrefix(realPath, dir+string(filepath.Separator)) ||
+						strings.HasPrefix(dir, realPath+string(filepath.Separator)) {
+						// Already walked or a cycle.
+						return filepath.SkipDir
+					}
+				}
+				visitedDirs = append(visitedDirs, realPath)
+				isDir = true
+			}
+			return callback(relPath, isDir)
+		},
+		ErrorCallback: func(path string, err error) godirwalk.ErrorAction {
+			// Broken symbolic links can't be followed.
+			if os.IsNotExist(err) {
+				return godirwalk.SkipNode
+			}
+			return godirwalk.Halt
 		},
-		Unsorted: true,
+		FollowSymbolicLinks: followSymlinks,
+		Unsorted:            true,
 	})
 }
@@ -0,0 +1,43 @@
+package repos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"repos/pkg/repos/meta"
+)
+
+func writeTestFile(t *testing.T, fn, content string) {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadProjectsWithBrokenSymlink(t *testing.T) {
+	for _, followSymlinks := range []bool{false, true} {
+		dir := t.TempDir()
+		rootMeta := "absolute-root: true\n"
+		if followSymlinks {
+			rootMeta += "follow-symlinks: true\n"
+		}
+		writeTestFile(t, filepath.Join(dir, meta.RootFile), rootMeta)
+		writeTestFile(t, filepath.Join(dir, "proj", ".repos", "project.yaml"), "name: proj\ntargets:\n  build: {}\n")
+		if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "broken")); err != nil {
+			t.Fatal(err)
+		}
+		repo, err := NewRepo(dir, RepoScopeGlobal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.LoadProjects(); err != nil {
+			t.Fatalf("LoadProjects with follow-symlinks=%v error: %v", followSymlinks, err)
+		}
+		if repo.FindProject("proj") == nil {
+			t.Errorf("project not found with follow-symlinks=%v", followSymlinks)
+		}
+	}
+}
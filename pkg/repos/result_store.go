@@ -0,0 +1,45 @@
+package repos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TaskResultStore persists task results across builds.
+type TaskResultStore interface {
+	// Load loads the result of the task. An error is returned if the result
+	// is not available.
+	Load(taskName string) (*TaskResult, error)
+	// Save saves the result of the task.
+	Save(taskName string, result *TaskResult) error
+}
+
+// FileResultStore stores task results as JSON files in a directory.
+type FileResultStore struct {
+	Dir string
+}
+
+// Load implements TaskResultStore.
+func (s *FileResultStore) Load(taskName string) (*TaskResult, error) {
+	return loadTaskResultFrom(s.fileName(taskName))
+}
+
+// Save implements TaskResultStore.
+func (s *FileResultStore) Save(taskName string, result *TaskResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("encode error: %w", err)
+	}
+	return os.WriteFile(s.fileName(taskName), data, 0644)
+}
+
+// remove invalidates the result before the task runs.
+func (s *FileResultStore) remove(taskName string) {
+	os.Remove(s.fileName(taskName))
+}
+
+func (s *FileResultStore) fileName(taskName string) string {
+	return filepath.Join(s.Dir, taskName+".result")
+}
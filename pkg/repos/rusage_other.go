@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package repos
+
+import "os"
+
+// processUsage is not supported on this platform.
+func processUsage(state *os.ProcessState) (peakRSS, userCPUNs int64) {
+	return 0, 0
+}
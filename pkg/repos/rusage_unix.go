@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package repos
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// processUsage extracts peak RSS (in bytes) and user CPU time (in nanoseconds)
+// from the state of an exited process.
+func processUsage(state *os.ProcessState) (peakRSS, userCPUNs int64) {
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return 0, 0
+	}
+	peakRSS = int64(ru.Maxrss)
+	// Maxrss is in bytes on darwin, kilobytes on others.
+	if runtime.GOOS != "darwin" {
+		peakRSS *= 1024
+	}
+	return peakRSS, ru.Utime.Nano()
+}
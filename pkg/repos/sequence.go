@@ -0,0 +1,54 @@
+package repos
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const buildSequenceFileName = "sequence"
+
+// buildSequenceLock serializes increments within the process, in addition
+// to the file lock which serializes increments across processes.
+var buildSequenceLock sync.Mutex
+
+// nextBuildSequence atomically increments the build sequence number
+// persisted in dataDir and returns the new value.
+func nextBuildSequence(dataDir string) (int64, error) {
+	buildSequenceLock.Lock()
+	defer buildSequenceLock.Unlock()
+
+	fn := filepath.Join(dataDir, buildSequenceFileName)
+	f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return 0, fmt.Errorf("lock %q error: %w", fn, err)
+	}
+	defer unlockFile(f)
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	var seq int64
+	if str := strings.TrimSpace(string(data)); str != "" {
+		if seq, err = strconv.ParseInt(str, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid content in %q: %w", fn, err)
+		}
+	}
+	seq++
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := f.WriteAt([]byte(strconv.FormatInt(seq, 10)), 0); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
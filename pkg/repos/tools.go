@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"text/template"
@@ -31,6 +32,22 @@ type ToolExecContext struct {
 	Stdout    io.Writer
 	Stderr    io.Writer
 	Logger    *log.Logger
+
+	// templateInputs collects files matched by templates (e.g. glob)
+	// which are registered as inputs to FilesCache.
+	templateInputs map[string]*fileEntry
+	// usage accumulates resource usage of commands executed by the tool.
+	usage *taskUsage
+	// cacheErrors counts failed cache operations.
+	cacheErrors *int
+	// metrics are reported by the tool about what it produced.
+	metrics map[string]string
+}
+
+// taskUsage is the resource usage of processes executed by a task.
+type taskUsage struct {
+	PeakRSS   int64
+	UserCPUNs int64
 }
 
 // ToolParamTemplate wraps text/template.Template with specific funcs.
@@ -94,10 +111,23 @@ func (c ToolExecContext) Output(outputs OutputFiles) {
 	c.Task.Outputs = &outputs
 }
 
+// Warn reports a warning of the task.
+func (c ToolExecContext) Warn(msg string) {
+	c.Logger.Printf("WARN %s", msg)
+	c.Task.Warnings = append(c.Task.Warnings, msg)
+}
+
+// ReportMetric reports a metric of the outputs, e.g. size or count.
+func (c ToolExecContext) ReportMetric(key, value string) {
+	c.Logger.Printf("METRIC %s=%s", key, value)
+	c.metrics[key] = value
+}
+
 // PersistCacheOrLog persists cache or logs on error.
 func (c ToolExecContext) PersistCacheOrLog(cache Cache) {
 	if err := cache.Persist(); err != nil {
 		c.Logger.Printf("Persist state error: %v", err)
+		c.countCacheError()
 	}
 }
 
@@ -105,12 +135,19 @@ func (c ToolExecContext) PersistCacheOrLog(cache Cache) {
 func (c ToolExecContext) ReplayAndPersistCacheOrLog(reporter *CacheReporter, cache Cache) Cache {
 	if err := reporter.Replay(cache); err != nil {
 		c.Logger.Printf("Refresh cache error: %v", err)
+		c.countCacheError()
 		return cache
 	}
 	c.PersistCacheOrLog(cache)
 	return cache
 }
 
+func (c ToolExecContext) countCacheError() {
+	if c.cacheErrors != nil {
+		*c.cacheErrors++
+	}
+}
+
 // RenderTemplates renders string list from templates.
 func (c ToolExecContext) RenderTemplates(templates []*ToolParamTemplate) ([]string, error) {
 	vals := make([]string, 0, len(templates))
@@ -134,35 +171,56 @@ func (c ToolExecContext) RenderEnvs(templates []*ToolParamTemplate) ([]string, e
 	return vals, nil
 }
 
-// Command creates an exec.Cmd.
+// Command creates an exec.Cmd running in the source directory.
 func (c ToolExecContext) Command(ctx context.Context, program string, args ...string) *exec.Cmd {
+	return c.WorkDirCommand(ctx, c.SourceDir(), program, args...)
+}
+
+// WorkDirCommand creates an exec.Cmd running in the specified working directory.
+func (c ToolExecContext) WorkDirCommand(ctx context.Context, workDir, program string, args ...string) *exec.Cmd {
 	cmd := exec.CommandContext(ctx, program, args...)
 	cmd.Env = append(os.Environ(), c.ExtraEnv...)
 	cmd.Stdout = c.Stdout
 	cmd.Stderr = c.Stderr
-	cmd.Dir = c.SourceDir()
+	cmd.Dir = workDir
 	return cmd
 }
 
 // ShellCommand creates an exec.Cmd to invoke a shell commandline.
 func (c ToolExecContext) ShellCommand(ctx context.Context, commandLine string) *exec.Cmd {
-	return c.Command(ctx, shellProgram(), "-c", commandLine)
+	return c.Command(ctx, c.Repo().ShellProgram(), "-c", commandLine)
 }
 
 // ShellScript creates an exec.Cmd to invoke a shell script.
 func (c ToolExecContext) ShellScript(ctx context.Context, script string, args ...string) *exec.Cmd {
-	cmd := c.Command(ctx, shellProgram(), script)
+	cmd := c.Command(ctx, c.Repo().ShellProgram(), script)
 	cmd.Args = append(cmd.Args, args...)
 	return cmd
 }
 
+// DockerCommand creates an exec.Cmd to run a command inside a container of the image.
+// The repository root is mounted at the same path inside the container, and the
+// command runs in the source directory. Environment variables in ExtraEnv are
+// forwarded to the container.
+func (c ToolExecContext) DockerCommand(ctx context.Context, image string, args ...string) *exec.Cmd {
+	rootDir := c.Repo().RootDir
+	dockerArgs := []string{"run", "--rm", "-i", "-v", rootDir + ":" + rootDir, "-w", c.SourceDir()}
+	for _, env := range c.ExtraEnv {
+		if pos := strings.Index(env, "="); pos > 0 {
+			dockerArgs = append(dockerArgs, "-e", env[:pos])
+		}
+	}
+	dockerArgs = append(dockerArgs, image)
+	return c.Command(ctx, "docker", append(dockerArgs, args...)...)
+}
+
 // ExtendEnv extends environment variables in existing command env.
 func (c ToolExecContext) ExtendEnv(cmd *exec.Cmd, envs ...string) {
 	keys := make(map[string]int)
 	for n, env := range cmd.Env {
 		items := strings.SplitN(env, "=", 2)
 		if len(items) == 2 {
-			keys[items[0]] = n
+			keys[envKey(items[0])] = n
 		}
 	}
 	for _, env := range envs {
@@ -174,7 +232,7 @@ func (c ToolExecContext) ExtendEnv(cmd *exec.Cmd, envs ...string) {
 		if pos <= 0 {
 			continue
 		}
-		key := env[:pos]
+		key := envKey(env[:pos])
 		if index, ok := keys[key]; ok {
 			cmd.Env[index] = env
 			continue
@@ -191,21 +249,56 @@ func (c ToolExecContext) AddBinToPathFromDeps(cmd *exec.Cmd) {
 	findBinDir(c.Task, &binList, visited)
 	var pathPrefix string
 	for elm := binList.Back(); elm != nil; elm = elm.Prev() {
-		pathPrefix += elm.Value.(string) + ":"
+		pathPrefix += elm.Value.(string) + string(filepath.ListSeparator)
 	}
 	for n, val := range cmd.Env {
-		if strings.HasPrefix(val, "PATH=") {
-			cmd.Env[n] = "PATH=" + pathPrefix + val[5:]
+		items := strings.SplitN(val, "=", 2)
+		if len(items) == 2 && envKey(items[0]) == envKey("PATH") {
+			cmd.Env[n] = items[0] + "=" + pathPrefix + items[1]
 			return
 		}
 	}
 	cmd.Env = append(cmd.Env, "PATH="+pathPrefix[:len(pathPrefix)-1])
 }
 
+// envKey normalizes the name of an environment variable for comparison.
+// Names are case-insensitive on Windows (e.g. PATH and Path).
+func envKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// recordUsage accumulates resource usage of an exited command.
+func (c ToolExecContext) recordUsage(cmd *exec.Cmd) {
+	if c.usage == nil || cmd.ProcessState == nil {
+		return
+	}
+	peakRSS, userCPUNs := processUsage(cmd.ProcessState)
+	if peakRSS > c.usage.PeakRSS {
+		c.usage.PeakRSS = peakRSS
+	}
+	c.usage.UserCPUNs += userCPUNs
+}
+
+func (c ToolExecContext) addTemplateInput(fn string) error {
+	if c.templateInputs == nil {
+		return nil
+	}
+	entry, err := newInputFileEntry(fn)
+	if err != nil {
+		return err
+	}
+	c.templateInputs[filepath.Clean(fn)] = entry
+	return nil
+}
+
 // RunAndLog logs command execution and result (no output).
 func (c ToolExecContext) RunAndLog(cmd *exec.Cmd) error {
 	c.Logger.Printf("CMD START %v", cmd.Args)
 	err := cmd.Run()
+	c.recordUsage(cmd)
 	if err != nil {
 		c.Logger.Printf("CMD FAILED %v: %v", cmd.Args, err)
 		return err
@@ -214,6 +307,18 @@ func (c ToolExecContext) RunAndLog(cmd *exec.Cmd) error {
 	return nil
 }
 
+// CaptureOutput runs the command and returns the captured stdout.
+// Stderr is written to c.Stderr.
+func (c ToolExecContext) CaptureOutput(cmd *exec.Cmd) (string, error) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = c.Stderr
+	if err := c.RunAndLog(cmd); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
 // NewToolParamTemplate creates a template by parsing content.
 func NewToolParamTemplate(content string) (*ToolParamTemplate, error) {
 	t := &ToolParamTemplate{}
@@ -228,10 +333,21 @@ func NewToolParamTemplate(content string) (*ToolParamTemplate, error) {
 // TemplateFuncs returns FuncMap to inject funcs into template.
 func (t *ToolParamTemplate) TemplateFuncs() template.FuncMap {
 	return template.FuncMap(map[string]interface{}{
-		"env":    t.fnEnv,
-		"depout": t.fnDepOut,
-		"depsrc": t.fnDepSrc,
-		"sh":     t.fnShell,
+		"env":       t.fnEnv,
+		"depout":    t.fnDepOut,
+		"depfiles":  t.fnDepFiles,
+		"depsrc":    t.fnDepSrc,
+		"sh":        t.fnShell,
+		"file":      t.fnFile,
+		"glob":      t.fnGlob,
+		"upper":     strings.ToUpper,
+		"lower":     strings.ToLower,
+		"trim":      strings.TrimSpace,
+		"trimLeft":  fnTrimLeft,
+		"trimRight": fnTrimRight,
+		"replace":   fnReplace,
+		"hasPrefix": fnHasPrefix,
+		"hasSuffix": fnHasSuffix,
 	})
 }
 
@@ -281,12 +397,43 @@ func (t *ToolParamTemplate) fnDepOut(depName, outKey string) (string, error) {
 		}
 	} else {
 		if val = task.Outputs.Extra[outKey]; val == "" {
+			val = task.Outputs.Dirs[outKey]
+		}
+		if val == "" {
 			return "", fmt.Errorf("no extra output %q from %q", depName, outKey)
 		}
 	}
 	return filepath.Join(task.Graph.Repo.OutDir(), task.Target.Project.Dir, val), nil
 }
 
+func (t *ToolParamTemplate) fnDepFiles(depName string) (string, error) {
+	task, err := t.findDep(depName)
+	if err != nil {
+		return "", err
+	}
+	if task.Outputs == nil {
+		return "", fmt.Errorf("no outputs from %q", depName)
+	}
+	outDir := filepath.Join(task.Graph.Repo.OutDir(), task.Target.Project.Dir)
+	var files []string
+	if task.Outputs.Primary != "" {
+		files = append(files, filepath.Join(outDir, task.Outputs.Primary))
+	}
+	for _, outputs := range []map[string]string{task.Outputs.Extra, task.Outputs.Dirs} {
+		keys := make([]string, 0, len(outputs))
+		for key := range outputs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if val := outputs[key]; val != "" {
+				files = append(files, filepath.Join(outDir, val))
+			}
+		}
+	}
+	return strings.Join(files, " "), nil
+}
+
 func (t *ToolParamTemplate) fnDepSrc(depName string) (string, error) {
 	task, err := t.findDep(depName)
 	if err != nil {
@@ -306,6 +453,72 @@ func (t *ToolParamTemplate) fnShell(commandline string) (string, error) {
 	return out.String(), nil
 }
 
+// fnFile reads a file relative to the project directory. The file is
+// registered as a cache input as the rendered value depends on its content.
+func (t *ToolParamTemplate) fnFile(fn string) (string, error) {
+	if !filepath.IsAbs(fn) {
+		fn = filepath.Join(t.ExecCtx.ProjectDir(), fn)
+	}
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return "", err
+	}
+	if err := t.ExecCtx.addTemplateInput(fn); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (t *ToolParamTemplate) fnGlob(pattern string) ([]string, error) {
+	srcDir := t.ExecCtx.SourceDir()
+	fullPattern := pattern
+	if !filepath.IsAbs(pattern) {
+		fullPattern = filepath.Join(srcDir, pattern)
+	}
+	matches, err := filepath.Glob(fullPattern)
+	if err != nil {
+		return nil, err
+	}
+	for n, fn := range matches {
+		if err := t.ExecCtx.addTemplateInput(fn); err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(pattern) {
+			if matches[n], err = filepath.Rel(srcDir, fn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return matches, nil
+}
+
+// fnReplace places the input string last to work in pipelines, e.g.
+// {{ sh "uname -m" | trim | replace "x86_64" "amd64" }}.
+func fnReplace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+// fnTrimLeft removes leading characters in cutset, e.g. {{ .Version | trimLeft "v" }}.
+func fnTrimLeft(cutset, s string) string {
+	return strings.TrimLeft(s, cutset)
+}
+
+// fnTrimRight removes trailing characters in cutset.
+func fnTrimRight(cutset, s string) string {
+	return strings.TrimRight(s, cutset)
+}
+
+// fnHasPrefix reports whether s begins with prefix, e.g.
+// {{ if env "GOOS" | hasPrefix "linux" }}.
+func fnHasPrefix(prefix, s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// fnHasSuffix reports whether s ends with suffix.
+func fnHasSuffix(suffix, s string) bool {
+	return strings.HasSuffix(s, suffix)
+}
+
 // CreateToolExecutor creates the ToolExecutor according to the tool.
 func CreateToolExecutor(t *Target) error {
 	if len(t.meta.Rule) > 1 {
@@ -347,7 +560,7 @@ func findBinDir(task *Task, binList *list.List, visited map[*Task]struct{}) {
 			continue
 		}
 		addBinDir(dep, binList, "bin")
-		if installDir := dep.Outputs.Extra["INSTALL_DIR"]; installDir != "" {
+		if installDir := dep.Outputs.Dirs["INSTALL_DIR"]; installDir != "" {
 			addBinDir(dep, binList, filepath.Join(installDir, "bin"))
 		}
 	}
@@ -362,6 +575,11 @@ func addBinDir(dep *Task, binList *list.List, prefix string) {
 			binList.PushBack(filepath.Join(dep.Target.Project.OutDir(), dir))
 		}
 	}
+	for _, val := range dep.Outputs.Dirs {
+		if dir := extractPathPrefix(val, prefix); dir != "" {
+			binList.PushBack(filepath.Join(dep.Target.Project.OutDir(), dir))
+		}
+	}
 }
 
 func extractPathPrefix(path, prefix string) string {
@@ -374,7 +592,9 @@ func extractPathPrefix(path, prefix string) string {
 	return ""
 }
 
-func shellProgram() string {
+// ShellProgram returns the default shell for executing command lines.
+// Use Repo.ShellProgram to respect the shell specified in root metadata.
+func ShellProgram() string {
 	if sh := os.Getenv("SHELL"); sh != "" {
 		return sh
 	}
@@ -2,6 +2,7 @@
 package cc
 
 import (
+	"bytes"
 	"container/list"
 	"context"
 	"fmt"
@@ -32,6 +33,15 @@ CFLAGS += \{{range .}}
 CXXFLAGS += \{{range .}}
 	{{.}} \
 {{- end}}{{- end}}
+{{with .LDFlags}}
+LDFLAGS += \{{range .}}
+	{{.}} \
+{{- end}}{{- end}}
+{{if .LTO}}
+ifneq ($(findstring Free Software Foundation,$(shell $(CROSS_COMPILE)$(CXX) --version)),)
+LDFLAGS += -fuse-linker-plugin
+endif
+{{end}}
 {{with .LibDirs}}
 LDFLAGS += \{{range .}}
 	-L{{.}} \
@@ -43,26 +53,37 @@ LIBS += \{{range .}}
 
 .SUFFIXES:
 .SUFFIXES: .c .cc .cpp .cxx .h .hpp .o
+{{with .PCH}}
+.DEFAULT_GOAL := all
+PCHFLAGS := -include {{$.ObjDir}}{{.Header}}
 
-%.o: %.c
+$(OBJECTS): {{$.ObjDir}}{{.Header}}.gch
+
+{{$.ObjDir}}{{.Header}}.gch: {{.Header}} {{$.Makefile}}
+	-mkdir -p $(dir $@)
+	{{.Rule}}
+{{end}}
+{{.ObjDir}}%.o: %.c
 	-mkdir -p $(dir $@)
-	$(CROSS_COMPILE)$(CC) $(CFLAGS) -MD -c -o $@ $<
+	$(CROSS_COMPILE)$(CC) $(CFLAGS) $(PCHFLAGS) -MD -c -o $@ $<
 
-%.o: %.cc
+{{.ObjDir}}%.o: %.cc
 	-mkdir -p $(dir $@)
-	$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) -MD -c -o $@ $<
+	$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) $(PCHFLAGS) -MD -c -o $@ $<
 
-%.o: %.cpp
+{{.ObjDir}}%.o: %.cpp
 	-mkdir -p $(dir $@)
-	$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) -MD -c -o $@ $<
+	$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) $(PCHFLAGS) -MD -c -o $@ $<
 
-%.o: %.cxx
+{{.ObjDir}}%.o: %.cxx
 	-mkdir -p $(dir $@)
-	$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) -MD -c -o $@ $<
+	$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) $(PCHFLAGS) -MD -c -o $@ $<
 
 .PHONY: all
 all: $(TARGET)
 
+$(OBJECTS): {{.Makefile}}
+
 {{.Target}}: $(OBJECTS) {{.Makefile}}
 	-mkdir -p $(dir $@)
 	{{.BinRule}}
@@ -82,6 +103,20 @@ type Params struct {
 	StaticLink  bool     `json:"static"`
 	IncludeDirs []string `json:"include-dirs"`
 	CXXStd      string   `json:"std"`
+	CStd        string   `json:"c-std"`
+	// Sanitizer enables a sanitizer: asan, ubsan or tsan.
+	Sanitizer string `json:"sanitizer"`
+	// PCH specifies a header to precompile and include in all sources.
+	PCH string `json:"pch"`
+	// LTO enables link-time optimization.
+	LTO bool `json:"lto"`
+}
+
+// sanitizerFlags maps values of Params.Sanitizer to compiler/linker flags.
+var sanitizerFlags = map[string]string{
+	"asan":  "-fsanitize=address",
+	"ubsan": "-fsanitize=undefined",
+	"tsan":  "-fsanitize=thread",
 }
 
 // Tool registers cc tool.
@@ -94,27 +129,38 @@ type Executor struct {
 	HeaderList  []string
 	IncludeDirs []string
 
-	data makefileData
+	data      makefileData
+	libDir    string
+	sanitizer string
 }
 
 type makefileData struct {
 	SourceDir   string
 	Target      string
+	ObjDir      string
 	Objects     []string
 	HdrDepFiles []string
 	BinRule     string
 	Makefile    string
 	CFlags      []string
 	CXXFlags    []string
+	LDFlags     []string
 	IncDirs     []string
 	LibDirs     []string
 	Libs        []string
+	PCH         *pchData
+	LTO         bool
+}
+
+type pchData struct {
+	Header string
+	Rule   string
 }
 
 // CreateToolExecutor implements repos.Tool.
 func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, error) {
 	var params Params
-	if err := target.ToolParamsAs(&params); err != nil {
+	if err := target.ToolParamsAsStrict(&params); err != nil {
 		return nil, fmt.Errorf("decode params error: %w", err)
 	}
 	if params.Output == "" {
@@ -131,6 +177,26 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 	if len(x.IncludeDirs) == 0 {
 		x.IncludeDirs = []string{"inc"}
 	}
+	binDir, libDir := "bin", "lib"
+	if params.Sanitizer != "" {
+		flag, ok := sanitizerFlags[params.Sanitizer]
+		if !ok {
+			return nil, fmt.Errorf("unsupported sanitizer %q", params.Sanitizer)
+		}
+		// CFLAGS is used for compiling both C and C++ sources.
+		x.data.CFlags = append(x.data.CFlags, flag)
+		x.data.LDFlags = append(x.data.LDFlags, flag)
+		// Avoid overwriting the outputs and objects of clean builds.
+		binDir, libDir = "bin-"+params.Sanitizer, "lib-"+params.Sanitizer
+		x.data.ObjDir = "obj-" + params.Sanitizer + "/"
+		x.sanitizer = params.Sanitizer
+	}
+	if params.LTO {
+		// CFLAGS is also used in the link rules.
+		x.data.CFlags = append(x.data.CFlags, "-flto")
+		x.data.LDFlags = append(x.data.LDFlags, "-flto")
+		x.data.LTO = true
+	}
 	x.data.SourceDir = target.SourceDir()
 	x.data.Objects = make([]string, len(x.SourceList))
 	x.data.HdrDepFiles = make([]string, 0, len(x.SourceList))
@@ -139,20 +205,20 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 		if pos <= 0 {
 			return nil, fmt.Errorf("invalid srcs[%d]: %q", n, src)
 		}
-		x.data.Objects[n] = src[:pos] + ".o"
+		x.data.Objects[n] = x.data.ObjDir + src[:pos] + ".o"
 		ext := src[pos:]
 		switch ext {
 		case ".c", ".cc", ".cpp", ".cxx":
-			x.data.HdrDepFiles = append(x.data.HdrDepFiles, src[:pos]+".d")
+			x.data.HdrDepFiles = append(x.data.HdrDepFiles, x.data.ObjDir+src[:pos]+".d")
 		}
 	}
 	if strings.HasPrefix(params.Output, "lib") {
 		switch {
 		case strings.HasSuffix(params.Output, ".a"):
-			x.data.Target = filepath.Join("lib", params.Output)
+			x.data.Target, x.libDir = filepath.Join(libDir, params.Output), libDir
 			x.data.BinRule = `$(CROSS_COMPLE)$(AR) $(ARFLAGS) $@ $(OBJECTS)`
 		case strings.HasSuffix(params.Output, ".so"):
-			x.data.Target = filepath.Join("lib", params.Output)
+			x.data.Target, x.libDir = filepath.Join(libDir, params.Output), libDir
 			if params.StaticLink {
 				return nil, fmt.Errorf("parameter static should be false for shared object")
 			}
@@ -160,7 +226,7 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 		}
 	}
 	if x.data.Target == "" {
-		x.data.Target = filepath.Join("bin", params.Output)
+		x.data.Target = filepath.Join(binDir, params.Output)
 		var static string
 		if params.StaticLink {
 			static = "-static "
@@ -168,11 +234,26 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 		x.data.BinRule = `$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) $(LDFLAGS) ` + static + `-o $@ $(OBJECTS) $(LIBS)`
 	}
 	x.data.CFlags = append(x.data.CFlags, "-g")
+	if params.CStd != "" {
+		x.data.CFlags = append(x.data.CFlags, "-std="+params.CStd)
+	}
 	cxxStd := params.CXXStd
 	if cxxStd == "" {
 		cxxStd = "c++17"
 	}
 	x.data.CXXFlags = append(x.data.CXXFlags, "-std="+cxxStd)
+	if params.PCH != "" {
+		// The header is compiled in the language of the sources, preferring C++.
+		rule := `$(CROSS_COMPILE)$(CC) $(CFLAGS) -x c-header -MD -o $@ $<`
+		for _, src := range x.SourceList {
+			switch filepath.Ext(src) {
+			case ".cc", ".cpp", ".cxx":
+				rule = `$(CROSS_COMPILE)$(CXX) $(CFLAGS) $(CXXFLAGS) -x c++-header -MD -o $@ $<`
+			}
+		}
+		x.data.PCH = &pchData{Header: params.PCH, Rule: rule}
+		x.data.HdrDepFiles = append(x.data.HdrDepFiles, x.data.ObjDir+params.PCH+".d")
+	}
 	x.data.Libs = make([]string, len(params.LinkLibs))
 	for n, val := range params.LinkLibs {
 		if strings.HasPrefix(val, "-") || strings.HasSuffix(val, ".a") || strings.HasSuffix(val, ".so") {
@@ -186,6 +267,9 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 
 // Execute implements repos.ToolExecutor.
 func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) error {
+	if x.data.LTO && x.sanitizer != "" {
+		xctx.Logger.Printf("WARN lto with sanitizer %s may not work with some compiler versions", x.sanitizer)
+	}
 	cr := &repos.CacheReporter{Cache: repos.NewFilesCache(xctx)}
 	for _, src := range x.SourceList {
 		if err := cr.AddSource(src); err != nil {
@@ -197,9 +281,15 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 			return fmt.Errorf("add header %q to cache failed: %w", hdr, err)
 		}
 	}
+	if pch := x.data.PCH; pch != nil {
+		if err := cr.AddSource(pch.Header); err != nil {
+			return fmt.Errorf("add pch %q to cache failed: %w", pch.Header, err)
+		}
+		cr.AddOutput("CC_PCH", x.data.ObjDir+pch.Header+".gch")
+	}
 	cr.AddOutput("", x.data.Target)
-	if strings.HasPrefix(x.data.Target, "lib/") {
-		cr.AddOutputDir("CC_LIB_DIR", "lib")
+	if x.libDir != "" {
+		cr.AddOutputDir("CC_LIB_DIR", x.libDir)
 	}
 	cr.AddOpaque(strings.Join(x.data.CFlags, " "))
 	cr.AddOpaque(strings.Join(x.data.CXXFlags, " "))
@@ -220,16 +310,17 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 
 	x.data.Makefile = xctx.Task.Target.Name.LocalName + ".mak"
 	makefile := filepath.Join(xctx.OutDir, x.data.Makefile)
-	f, err := os.Create(makefile)
-	if err != nil {
-		return fmt.Errorf("create %q error: %w", makefile, err)
+	var content bytes.Buffer
+	if err := makefileTemplate.Execute(&content, &x.data); err != nil {
+		return fmt.Errorf("generate %q error: %w", makefile, err)
 	}
-	defer f.Close()
-	if err := makefileTemplate.Execute(f, &x.data); err != nil {
-		return fmt.Errorf("write %q error: %w", makefile, err)
+	// Objects depend on the makefile for changes of flags, so only write it
+	// when the content changes to keep incremental builds.
+	if existing, err := os.ReadFile(makefile); err != nil || !bytes.Equal(existing, content.Bytes()) {
+		if err := os.WriteFile(makefile, content.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write %q error: %w", makefile, err)
+		}
 	}
-	// Close makefile early to flush all data and allow make to access.
-	f.Close()
 
 	if err := xctx.RunAndLog(xctx.Command(ctx, "make", "-f", x.data.Makefile, "-C", xctx.OutDir)); err != nil {
 		return fmt.Errorf("run make error: %w", err)
@@ -255,10 +346,10 @@ func findCCDeps(task *repos.Task, incList, libList *list.List, visited map[*repo
 		if dep.Outputs == nil {
 			continue
 		}
-		if dir := dep.Outputs.Extra["CC_INC_DIR"]; dir != "" {
+		if dir := dep.Outputs.Dirs["CC_INC_DIR"]; dir != "" {
 			incList.PushBack(filepath.Join(dep.Target.Project.OutDir(), dir))
 		}
-		if dir := dep.Outputs.Extra["CC_LIB_DIR"]; dir != "" {
+		if dir := dep.Outputs.Dirs["CC_LIB_DIR"]; dir != "" {
 			libList.PushBack(filepath.Join(dep.Target.Project.OutDir(), dir))
 		}
 	}
@@ -13,15 +13,18 @@ import (
 
 // Params defines the parameters.
 type Params struct {
-	Command    string            `json:"command"`
-	ScriptFile string            `json:"script-file"`
-	Args       []string          `json:"args"`
-	Env        []string          `json:"env"`
-	Srcs       []string          `json:"srcs"`
-	Out        string            `json:"out"`
-	ExtraOut   map[string]string `json:"extra-out"`
-	Generated  []string          `json:"generated"`
-	Opaque     []string          `json:"opaque"`
+	Command     string            `json:"command"`
+	ScriptFile  string            `json:"script-file"`
+	Args        []string          `json:"args"`
+	Env         []string          `json:"env"`
+	Srcs        []string          `json:"srcs"`
+	Out         string            `json:"out"`
+	ExtraOut    map[string]string `json:"extra-out"`
+	Generated   []string          `json:"generated"`
+	Opaque      []string          `json:"opaque"`
+	WorkDir     string            `json:"workdir"`
+	Stdin       string            `json:"stdin"`
+	DockerImage string            `json:"docker-image"`
 }
 
 // Tool defines the tool to be registered.
@@ -35,12 +38,14 @@ type Executor struct {
 	ArgTemplates    []*repos.ToolParamTemplate
 	EnvTemplates    []*repos.ToolParamTemplate
 	OpaqueTemplates []*repos.ToolParamTemplate
+	WorkDirTemplate *repos.ToolParamTemplate
+	StdinTemplate   *repos.ToolParamTemplate
 }
 
 // CreateToolExecutor implements repos.Tool.
 func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, error) {
 	var params Params
-	err := target.ToolParamsAs(&params)
+	err := target.ToolParamsAsStrict(&params)
 	if err != nil {
 		return nil, fmt.Errorf("decode params error: %w", err)
 	}
@@ -53,6 +58,9 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 	if params.Command != "" && len(params.Args) > 0 {
 		return nil, fmt.Errorf("args can only be used with script-file, not command")
 	}
+	if params.DockerImage != "" && params.WorkDir != "" {
+		return nil, fmt.Errorf("workdir can't be used with docker-image")
+	}
 
 	x := &Executor{
 		Params:          params,
@@ -81,6 +89,16 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 			return nil, fmt.Errorf("invalid parameter opaque[%d]: %w", n, err)
 		}
 	}
+	if params.WorkDir != "" {
+		if x.WorkDirTemplate, err = repos.NewToolParamTemplate(params.WorkDir); err != nil {
+			return nil, fmt.Errorf("invalid parameter workdir: %w", err)
+		}
+	}
+	if params.Stdin != "" {
+		if x.StdinTemplate, err = repos.NewToolParamTemplate(params.Stdin); err != nil {
+			return nil, fmt.Errorf("invalid parameter stdin: %w", err)
+		}
+	}
 	return x, nil
 }
 
@@ -134,18 +152,52 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 	}
 	cr.AddOpaque(envs...)
 	cr.AddOpaque(x.Params.Opaque...)
+	if x.Params.DockerImage != "" {
+		cr.AddOpaque(x.Params.DockerImage)
+	}
+	var workDir string
+	if x.WorkDirTemplate != nil {
+		if workDir, err = x.renderWorkDir(xctx); err != nil {
+			return err
+		}
+		cr.AddOpaque(workDir)
+	}
+	var stdin string
+	if x.StdinTemplate != nil {
+		if stdin, err = x.StdinTemplate.ExecWith(xctx, nil); err != nil {
+			return fmt.Errorf("rendering parameter stdin error: %w", err)
+		}
+		cr.AddOpaque(stdin)
+	}
 	if xctx.Skippable && cr.Verify() {
 		xctx.Output(cr.SavedTaskOutputs())
 		return repos.ErrSkipped
 	}
 	cr.ClearSaved()
 	var cmd *exec.Cmd
-	if x.CommandTemplate != nil {
-		cmd = xctx.ShellCommand(ctx, command)
+	if x.Params.DockerImage != "" {
+		cmd = x.dockerCommand(ctx, xctx, command, args, envs)
 	} else {
-		cmd = xctx.ShellScript(ctx, x.Params.ScriptFile, args...)
+		switch {
+		case workDir == "" && x.CommandTemplate != nil:
+			cmd = xctx.ShellCommand(ctx, command)
+		case workDir == "":
+			cmd = xctx.ShellScript(ctx, x.Params.ScriptFile, args...)
+		case x.CommandTemplate != nil:
+			cmd = xctx.WorkDirCommand(ctx, workDir, xctx.Repo().ShellProgram(), "-c", command)
+		default:
+			// The script file is relative to the source directory.
+			script := x.Params.ScriptFile
+			if !filepath.IsAbs(script) {
+				script = filepath.Join(xctx.SourceDir(), script)
+			}
+			cmd = xctx.WorkDirCommand(ctx, workDir, xctx.Repo().ShellProgram(), append([]string{script}, args...)...)
+		}
+		xctx.AddBinToPathFromDeps(cmd)
+	}
+	if x.StdinTemplate != nil {
+		cmd.Stdin = strings.NewReader(stdin)
 	}
-	xctx.AddBinToPathFromDeps(cmd)
 	xctx.ExtendEnv(cmd, envs...)
 	if err := xctx.RunAndLog(cmd); err != nil {
 		return err
@@ -155,6 +207,33 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 	return nil
 }
 
+// dockerCommand runs the command or script using the shell inside the container.
+// The rendered envs are forwarded to the container in addition to ExtraEnv.
+func (x *Executor) dockerCommand(ctx context.Context, xctx *repos.ToolExecContext, command string, args, envs []string) *exec.Cmd {
+	dctx := *xctx
+	dctx.ExtraEnv = append(append([]string{}, xctx.ExtraEnv...), envs...)
+	if x.CommandTemplate != nil {
+		return dctx.DockerCommand(ctx, x.Params.DockerImage, "sh", "-c", command)
+	}
+	return dctx.DockerCommand(ctx, x.Params.DockerImage, append([]string{"sh", x.Params.ScriptFile}, args...)...)
+}
+
+func (x *Executor) renderWorkDir(xctx *repos.ToolExecContext) (string, error) {
+	dir, err := x.WorkDirTemplate.ExecWith(xctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("rendering parameter workdir error: %w", err)
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(xctx.SourceDir(), dir)
+	}
+	dir = filepath.Clean(dir)
+	rootDir := filepath.Clean(xctx.Repo().RootDir)
+	if dir != rootDir && !strings.HasPrefix(dir, rootDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("workdir %q is outside of repository root %q", dir, rootDir)
+	}
+	return dir, nil
+}
+
 func init() {
 	repos.RegisterTool("exec", &Tool{})
 }
@@ -4,6 +4,8 @@ package ext
 import (
 	"context"
 	"fmt"
+	"os/exec"
+	"time"
 
 	"repos/pkg/repos"
 )
@@ -12,6 +14,7 @@ import (
 type Params struct {
 	Command string   `json:"command"`
 	Env     []string `json:"env"`
+	Timeout string   `json:"timeout"`
 }
 
 // Tool defines the tool to be registered.
@@ -22,12 +25,13 @@ type Tool struct {
 type Executor struct {
 	CommandTemplate *repos.ToolParamTemplate
 	EnvTemplates    []*repos.ToolParamTemplate
+	Timeout         time.Duration
 }
 
 // CreateToolExecutor implements repos.Tool.
 func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, error) {
 	var params Params
-	err := target.ToolParamsAs(&params)
+	err := target.ToolParamsAsStrict(&params)
 	if err != nil {
 		return nil, fmt.Errorf("decode params error: %w", err)
 	}
@@ -47,6 +51,15 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 		}
 	}
 
+	if params.Timeout != "" {
+		if x.Timeout, err = time.ParseDuration(params.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid parameter timeout: %w", err)
+		}
+		if x.Timeout < 0 {
+			return nil, fmt.Errorf("invalid parameter timeout: negative duration %q", params.Timeout)
+		}
+	}
+
 	return x, nil
 }
 
@@ -60,7 +73,10 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 	if err != nil {
 		return fmt.Errorf("envs: %w", err)
 	}
-	return repos.ExecuteExtToolCmd(ctx, xctx, xctx.ShellCommand(ctx, command), envs...)
+	createCmd := func(ctx context.Context) *exec.Cmd {
+		return xctx.ShellCommand(ctx, command)
+	}
+	return repos.ExecuteExtToolCmdWithTimeout(ctx, xctx, x.Timeout, createCmd, envs...)
 }
 
 func init() {
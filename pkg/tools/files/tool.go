@@ -29,7 +29,7 @@ type Executor struct {
 // CreateToolExecutor implements repos.Tool.
 func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, error) {
 	x := &Executor{}
-	err := target.ToolParamsAs(&x.Params)
+	err := target.ToolParamsAsStrict(&x.Params)
 	if err != nil {
 		return nil, fmt.Errorf("decode params error: %w", err)
 	}
@@ -7,10 +7,12 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
@@ -31,6 +33,10 @@ type Params struct {
 	Digest    string `json:"digest"`
 	UnpackTo  string `json:"unpack-to"`
 	UseSubDir string `json:"use-subdir"`
+	// Insecure skips the verification of TLS certificates.
+	Insecure bool `json:"insecure"`
+	// UserAgent overrides the User-Agent header.
+	UserAgent string `json:"user-agent"`
 }
 
 // Tool defines the tool to be registered.
@@ -45,6 +51,8 @@ type Executor struct {
 	DigestValue  string
 	UnpackOutDir string
 	UseSubDir    string
+	Insecure     bool
+	UserAgent    string
 
 	digester func() hash.Hash
 	unpacker func(ctx context.Context, xctx *repos.ToolExecContext, fn, dir string) *exec.Cmd
@@ -53,7 +61,7 @@ type Executor struct {
 // CreateToolExecutor implements repos.Tool.
 func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, error) {
 	var params Params
-	if err := target.ToolParamsAs(&params); err != nil {
+	if err := target.ToolParamsAsStrict(&params); err != nil {
 		return nil, fmt.Errorf("decode params error: %w", err)
 	}
 	if params.URL == "" {
@@ -75,6 +83,8 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 		Filename:    params.Filename,
 		DigestAlgo:  strings.ToLower(digests[0]),
 		DigestValue: digests[1],
+		Insecure:    params.Insecure,
+		UserAgent:   params.UserAgent,
 	}
 	if x.Filename == "" {
 		x.Filename = filepath.Base(x.URL.EscapedPath())
@@ -138,9 +148,8 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 	outFn := filepath.Join(xctx.OutDir, x.Filename)
 	if !x.validateDigest(xctx) {
 		os.Remove(outFn)
-		downloadURL := x.URL.String()
-		if err := xctx.RunAndLog(xctx.Command(ctx, "curl", "-fsSL", "-o", outFn, downloadURL)); err != nil {
-			return fmt.Errorf("download %q error: %v", downloadURL, err)
+		if err := x.download(ctx, xctx, outFn); err != nil {
+			return fmt.Errorf("download %q error: %v", x.URL.String(), err)
 		}
 	}
 	if x.unpacker != nil {
@@ -171,6 +180,53 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 	return nil
 }
 
+// download streams the content from the URL into outFn and verifies the
+// digest on the fly. outFn is only created when the digest matches.
+func (x *Executor) download(ctx context.Context, xctx *repos.ToolExecContext, outFn string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, x.URL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if x.UserAgent != "" {
+		req.Header.Set("User-Agent", x.UserAgent)
+	}
+	client := http.DefaultClient
+	if x.Insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		client = &http.Client{Transport: transport}
+	}
+	xctx.Logger.Printf("GET %s", req.URL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	xctx.Logger.Printf("GET %s: %s", req.URL, resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	tmpFn := outFn + ".download"
+	f, err := os.Create(tmpFn)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFn)
+	h := x.digester()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if val := hex.EncodeToString(h.Sum(nil)); val != x.DigestValue {
+		return fmt.Errorf("inconsistent digest: %s vs %s (desired)", val, x.DigestValue)
+	}
+	return os.Rename(tmpFn, outFn)
+}
+
 func (x *Executor) validateDigest(xctx *repos.ToolExecContext) bool {
 	outFn := filepath.Join(xctx.OutDir, x.Filename)
 	f, err := os.Open(outFn)
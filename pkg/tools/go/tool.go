@@ -20,6 +20,9 @@ type Params struct {
 	BuildMode string `json:"buildmode,omitempty"`
 	// CGo specifies whether CGo should be enabled (disabled by default).
 	CGo bool `json:"cgo,omitempty"`
+	// Race enables the race detector. The output is placed in bin-race (or
+	// lib-race) to avoid overwriting the output of a regular build.
+	Race bool `json:"race,omitempty"`
 	// GoOS specifies GOOS environment variable if present.
 	GoOS string `json:"goos,omitempty"`
 	// GoArch specifies GOARCH environment variable if present.
@@ -32,6 +35,14 @@ type Params struct {
 	GoArgs []string `json:"args,omitempty"`
 	// Output specifies output filename.
 	Output string `json:"output,omitempty"`
+	// ModCache overrides GOMODCACHE, relative to the root of the repository
+	// if not absolute. Templates are supported.
+	ModCache string `json:"modcache,omitempty"`
+	// WorkFile specifies the go.work file for workspace mode, relative to
+	// the root of the repository if not absolute, or "off" to disable
+	// workspace mode. By default, go.work in the root of the repository is
+	// used if present.
+	WorkFile string `json:"workfile,omitempty"`
 }
 
 // Tool defines a Go Tool.
@@ -46,8 +57,11 @@ type Executor struct {
 	ExtraArgs    []*repos.ToolParamTemplate
 	Output       string
 	CLib         bool
+	ModCache     *repos.ToolParamTemplate
+	WorkFile     string
 
 	stateOpaque []string
+	libDir      string
 }
 
 type listPackage struct {
@@ -76,18 +90,23 @@ type listPackage struct {
 // CreateToolExecutor implements repos.Tool.
 func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, error) {
 	var params Params
-	if err := target.ToolParamsAs(&params); err != nil {
+	if err := target.ToolParamsAsStrict(&params); err != nil {
 		return nil, fmt.Errorf("decode params error: %w", err)
 	}
-	x := &Executor{Packages: params.Packages}
+	x := &Executor{Packages: params.Packages, WorkFile: params.WorkFile, libDir: "lib"}
+	binDir := "bin"
+	if params.Race {
+		binDir, x.libDir = "bin-race", "lib-race"
+	}
 	switch params.BuildMode {
 	case "c-archive", "c-shared", "shared", "plugin":
-		x.Output = filepath.Join("lib", params.Output)
+		x.Output = filepath.Join(x.libDir, params.Output)
 		x.ExtraEnv = append(x.ExtraEnv, "CGO_ENABLED=1")
 		x.CLib = true
 	case "", "exe", "pie":
-		x.Output = filepath.Join("bin", params.Output)
-		if params.CGo {
+		x.Output = filepath.Join(binDir, params.Output)
+		// The race detector requires cgo.
+		if params.CGo || params.Race {
 			x.ExtraEnv = append(x.ExtraEnv, "CGO_ENABLED=1")
 		} else {
 			x.ExtraEnv = append(x.ExtraEnv, "CGO_ENABLED=0")
@@ -98,6 +117,9 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 	if params.BuildMode != "" {
 		x.BuildOptions = append(x.BuildOptions, "-buildmode", params.BuildMode)
 	}
+	if params.Race {
+		x.BuildOptions = append(x.BuildOptions, "-race")
+	}
 	if params.GoOS != "" {
 		x.ExtraEnv = append(x.ExtraEnv, "GOOS="+params.GoOS)
 	}
@@ -115,6 +137,12 @@ func (t *Tool) CreateToolExecutor(target *repos.Target) (repos.ToolExecutor, err
 		}
 		x.ExtraArgs = append(x.ExtraArgs, tpl)
 	}
+	if params.ModCache != "" {
+		var err error
+		if x.ModCache, err = repos.NewToolParamTemplate(params.ModCache); err != nil {
+			return nil, fmt.Errorf("invalid parameter modcache: %w", err)
+		}
+	}
 	if x.Output == "" {
 		x.Output = target.Name.LocalName
 	}
@@ -128,8 +156,34 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 	if err != nil {
 		return fmt.Errorf("args: %w", err)
 	}
+	goVersion, err := x.goVersion(ctx, xctx)
+	if err != nil {
+		return fmt.Errorf("go version: %w", err)
+	}
+	xctx.ExtraEnv = append(xctx.ExtraEnv, "REPOS_GO_VERSION="+goVersion)
 	cache := repos.NewFilesCache(xctx)
-	if x.validateCache(ctx, xctx, cache, extraArgs) {
+	// Changing the Go toolchain invalidates the cache.
+	cache.AddOpaque("go" + goVersion)
+	if x.ModCache != nil {
+		modCache, err := x.ModCache.ExecWith(xctx, nil)
+		if err != nil {
+			return fmt.Errorf("rendering parameter modcache error: %w", err)
+		}
+		// An empty value (e.g. from an unset environment variable) keeps the default.
+		if modCache != "" {
+			if !filepath.IsAbs(modCache) {
+				modCache = filepath.Join(xctx.Repo().RootDir, modCache)
+			}
+			xctx.ExtraEnv = append(xctx.ExtraEnv, "GOMODCACHE="+modCache)
+			cache.AddOpaque("GOMODCACHE=" + modCache)
+		}
+	}
+	workFile := x.findWorkFile(xctx)
+	if workFile != "" {
+		xctx.ExtraEnv = append(xctx.ExtraEnv, "GOWORK="+workFile)
+		cache.AddOpaque("GOWORK=" + workFile)
+	}
+	if x.validateCache(ctx, xctx, cache, extraArgs, workFile) {
 		xctx.Output(cache.SavedTaskOutputs())
 		return repos.ErrSkipped
 	}
@@ -144,7 +198,26 @@ func (x *Executor) Execute(ctx context.Context, xctx *repos.ToolExecContext) err
 	return nil
 }
 
-func (x *Executor) validateCache(ctx context.Context, xctx *repos.ToolExecContext, cache *repos.FilesCache, extraArgs []string) bool {
+// findWorkFile returns the value of GOWORK, or empty if it should be left
+// unset.
+func (x *Executor) findWorkFile(xctx *repos.ToolExecContext) string {
+	switch x.WorkFile {
+	case "off":
+		return x.WorkFile
+	case "":
+		fn := filepath.Join(xctx.Repo().RootDir, "go.work")
+		if _, err := os.Stat(fn); err != nil {
+			return ""
+		}
+		return fn
+	}
+	if filepath.IsAbs(x.WorkFile) {
+		return x.WorkFile
+	}
+	return filepath.Join(xctx.Repo().RootDir, x.WorkFile)
+}
+
+func (x *Executor) validateCache(ctx context.Context, xctx *repos.ToolExecContext, cache *repos.FilesCache, extraArgs []string, workFile string) bool {
 	cmd := x.goCmd(ctx, xctx, "list", "-json", "-deps")
 	var out bytes.Buffer
 	cmd.Stdout, cmd.Stderr = io.MultiWriter(&out, xctx.LogWriter), xctx.LogWriter
@@ -175,16 +248,53 @@ func (x *Executor) validateCache(ctx context.Context, xctx *repos.ToolExecContex
 			return false
 		}
 	}
+	if workFile != "" && workFile != "off" {
+		// Changes to the set of workspace modules affect the build.
+		for _, fn := range []string{workFile, workFile + ".sum"} {
+			if _, err := os.Stat(fn); err != nil && fn != workFile {
+				// go.work.sum is optional.
+				continue
+			}
+			relPath, err := filepath.Rel(xctx.SourceDir(), fn)
+			if err == nil {
+				err = cache.AddInput(relPath, false)
+			}
+			if err != nil {
+				xctx.Logger.Printf("add input %q to state failed: %v", fn, err)
+				return false
+			}
+		}
+	}
 	cache.AddOutput("", x.Output)
 	if x.CLib {
-		cache.AddOutput("CC_INC_DIR", "lib/")
-		cache.AddOutput("CC_LIB_DIR", "lib/")
+		cache.AddOutputDir("CC_INC_DIR", x.libDir)
+		cache.AddOutputDir("CC_LIB_DIR", x.libDir)
 	}
 	cache.AddOpaque(x.stateOpaque...)
 	cache.AddOpaque(extraArgs...)
 	return xctx.Skippable && cache.Verify()
 }
 
+// goVersion returns the version of the Go toolchain without the "go" prefix,
+// e.g. 1.21.3.
+func (x *Executor) goVersion(ctx context.Context, xctx *repos.ToolExecContext) (string, error) {
+	cmd := xctx.Command(ctx, "go", "version")
+	cmd.Env = append(cmd.Env, x.ExtraEnv...)
+	out, err := xctx.CaptureOutput(cmd)
+	if err != nil {
+		return "", err
+	}
+	// The output looks like "go version go1.21.3 linux/amd64", or
+	// "go version devel go1.22-abcdef ..." for development builds.
+	fields := strings.Fields(out)
+	for n := 2; n < len(fields); n++ {
+		if strings.HasPrefix(fields[n], "go") && len(fields[n]) > 2 {
+			return strings.TrimPrefix(fields[n], "go"), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized output %q", strings.TrimSpace(out))
+}
+
 func (x *Executor) goCmd(ctx context.Context, xctx *repos.ToolExecContext, args ...string) *exec.Cmd {
 	cmd := xctx.Command(ctx, "go", args...)
 	if args[0] == "build" {